@@ -2,10 +2,15 @@ package main
 
 import (
 	"7go/wangCache/wangcache"
+	"7go/wangCache/wangcache/logger"
+	"7go/wangCache/wangcache/membership"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
 )
 
@@ -16,6 +21,9 @@ var db = map[string]string{
 	"Sam": "567",
 }
 
+// 缓存和节点的日志使用标准库的 slog，默认输出 Info 及以上级别
+var logs = logger.Slog(slog.Default())
+
 func createGroup() *wangcache.Group {
 	return wangcache.NewGroup("scores", 2<<10, wangcache.GetterFunc(
 		func(key string) ([]byte, error) {
@@ -28,16 +36,40 @@ func createGroup() *wangcache.Group {
 				return []byte(val), nil
 			}
 
-			err := fmt.Errorf("key:[%s] not exist", key)
+			// 返回 ErrNotFound 才能让 Group 对不存在的key进行负缓存
+			err := fmt.Errorf("key:[%s] not exist: %w", key, wangcache.ErrNotFound)
 			log.Printf("get data from db failed, %s\n", err.Error())
 			return nil, err
-		}))
+		}),
+		// 缓存1分钟过期，并加上最多10秒的随机抖动，避免同一批key同时失效
+		wangcache.WithTTL(time.Minute, 10*time.Second),
+		// 不存在的key在5秒内不再回源查询，防止缓存穿透
+		wangcache.WithNegativeCache(5*time.Second, 1<<10),
+		// 缓存未命中时最多等待3秒，超时后放弃访问远程节点和数据库
+		wangcache.WithTimeout(3*time.Second),
+		wangcache.WithLogger(logs))
 }
 
 // 启动缓存服务器：创建 HTTPPool，添加节点信息，注册到 gee 中，启动 HTTP 服务（共3个端口，8001/8002/8003），用户不感知
-func startCacheServer(addr string, addrs []string, group *wangcache.Group) {
-	peers := wangcache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+// seeds 不为空时不使用 addrs，而是通过 gossip 协议发现其他节点
+// peersToken 不为空时允许通过 _peers 接口添加和移除节点
+func startCacheServer(addr string, addrs []string, gossipAddr string, seeds []string, peersToken string, group *wangcache.Group) {
+	// 每5秒检查一次其他节点，连续失败3次移出哈希环，连续成功2次重新加入
+	peers := wangcache.NewHTTPPool(addr, wangcache.WithHealthCheck(5*time.Second, time.Second, 3, 2), wangcache.WithPoolLogger(logs),
+		wangcache.WithPeersToken(peersToken))
+	if len(seeds) == 0 {
+		peers.Set(addrs...)
+	} else {
+		peers.Set(addr)
+		members, err := membership.New(addr, gossipAddr, membership.WithRing(peers), membership.WithLogger(logs))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := members.Join(seeds...); err != nil {
+			log.Println(err)
+		}
+		log.Println("gossip is running at ", gossipAddr)
+	}
 	group.RegisterPeers(peers)
 	log.Println("wangCache is running at ", addr)
 
@@ -50,7 +82,8 @@ func startAPIServer(apiAddr string, group *wangcache.Group) {
 	http.Handle("/api", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("-----api request deal starting-----")
 		key := r.URL.Query().Get("key")
-		view, err := group.Get(key)
+		// 客户端断开连接后，正在进行的远程请求和回源查询随之取消
+		view, err := group.GetContext(r.Context(), key)
 
 		log.Printf("-----api request deal is end-----")
 		if err != nil {
@@ -69,13 +102,22 @@ func startAPIServer(apiAddr string, group *wangcache.Group) {
 func main() {
 	var port int
 	var api bool
+	var seeds string
+	var peersToken string
 
 	flag.IntVar(&port, "port", 8001, "wangCache server port")
 	flag.BoolVar(&api, "api", false, "start a api server?")
+	// 如 -seeds=localhost:9001，gossip 监听的端口为 port+1000
+	flag.StringVar(&seeds, "seeds", "", "gossip seed addresses separated by comma, discover peers by gossip instead of the hardcoded list")
+	flag.StringVar(&peersToken, "peers-token", "", "token required to add or remove peers through /_wangcache/_peers, empty disables it")
 	flag.Parse()
 
 	// 定义了apiServer的地址和三个cacheServer的地址
 	// 这里属于硬编码，可以考虑使用配置文件的方式来动态修改
+	// 以 -peers-token=<token> 启动时，运行期间扩缩容可以调用每个节点的 /_wangcache/_peers 接口，如:
+	//   curl -X POST -H 'X-Wangcache-Token: <token>' 'http://localhost:8001/_wangcache/_peers?peer=http://localhost:8004'
+	// 每个节点的统计数据 (Prometheus 文本格式) 在 /_wangcache/_metrics，如:
+	//   curl http://localhost:8001/_wangcache/_metrics
 	apiAddr := "http://localhost:9999"
 	addrMap := map[int]string{
 		8001: "http://localhost:8001",
@@ -93,5 +135,9 @@ func main() {
 		go startAPIServer(apiAddr, group)
 	}
 
-	startCacheServer(addrMap[port], addrs, group)
+	var seedList []string
+	if seeds != "" {
+		seedList = strings.Split(seeds, ",")
+	}
+	startCacheServer(fmt.Sprintf("http://localhost:%d", port), addrs, fmt.Sprintf("localhost:%d", port+1000), seedList, peersToken, group)
 }
@@ -0,0 +1,252 @@
+package arc
+
+import (
+	"7go/wangCache/wangcache/policy"
+	"container/list"
+	"time"
+)
+
+//实现 ARC (Adaptive Replacement Cache) 缓存淘汰算法
+
+//ARC 同时维护两个LRU队列：T1 保存只被访问过一次的记录(近期性)，T2 保存被访问过至少两次的记录(频率性)；
+//另外还有两个"幽灵"队列 B1、B2，只保存最近从 T1、T2 中被淘汰的key，不保存值。
+//当新增的key命中 B1 时，说明 T1 太小了，就增大 T1 的目标大小 p；命中 B2 时则减小 p。
+//由此 ARC 能根据访问模式在 LRU 和 LFU 之间自适应调整，并且可以抵抗一次性的大范围扫描。
+//原始论文中各队列的大小按记录个数计算，这里统一按字节数计算，与其他淘汰算法的 maxBytes 语义保持一致。
+
+// Cache is an ARC cache. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes int64 // 缓存允许使用的最大字节数
+	p        int64 // T1 的目标字节数，根据幽灵队列的命中情况自适应调整
+	t1, t2   *arcList
+	b1, b2   *arcList
+	// optional and executed when an entry is purged.
+	// 某条记录被移除时的回调函数，可以为 nil
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value     // 幽灵队列中的记录 value 为 nil
+	size   int64     // 记录占用的字节数，幽灵队列中保留被淘汰时的大小
+	expire time.Time // 过期时间，零值表示永不过期
+}
+
+// 判断记录在 now 时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// arcList 是带字节统计的LRU队列，队首为最近访问的记录
+type arcList struct {
+	ll     *list.List
+	items  map[string]*list.Element
+	nbytes int64
+}
+
+func newArcList() *arcList {
+	return &arcList{ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (l *arcList) pushFront(e *entry) {
+	l.items[e.key] = l.ll.PushFront(e)
+	l.nbytes += e.size
+}
+
+func (l *arcList) remove(ele *list.Element) *entry {
+	e := l.ll.Remove(ele).(*entry)
+	delete(l.items, e.key)
+	l.nbytes -= e.size
+	return e
+}
+
+// 移除并返回队尾(最久未访问)的记录
+func (l *arcList) removeBack() *entry {
+	ele := l.ll.Back()
+	if ele == nil {
+		return nil
+	}
+	return l.remove(ele)
+}
+
+// Value use Len() to count how many bytes it takes
+type Value = policy.Value
+
+var _ policy.Cache = (*Cache)(nil)
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        newArcList(),
+		t2:        newArcList(),
+		b1:        newArcList(),
+		b2:        newArcList(),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 获取缓存，命中的记录都会被移动到 T2 的队首
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	for _, l := range []*arcList{c.t1, c.t2} {
+		if ele, hit := l.items[key]; hit {
+			e := ele.Value.(*entry)
+			if e.expired(time.Now()) {
+				c.evict(l, ele)
+				return nil, false
+			}
+			c.t2.pushFront(l.remove(ele))
+			return e.value, true
+		}
+	}
+	return
+}
+
+// 移除指定的缓存，同时从幽灵队列中移除
+func (c *Cache) Remove(key string) {
+	for _, l := range []*arcList{c.t1, c.t2} {
+		if ele, ok := l.items[key]; ok {
+			c.evict(l, ele)
+		}
+	}
+	for _, l := range []*arcList{c.b1, c.b2} {
+		if ele, ok := l.items[key]; ok {
+			l.remove(ele)
+		}
+	}
+}
+
+// 清空所有缓存和幽灵队列，每条记录都会触发回调函数
+func (c *Cache) Purge() {
+	for _, l := range []*arcList{c.t1, c.t2} {
+		for ele := l.ll.Back(); ele != nil; ele = l.ll.Back() {
+			c.evict(l, ele)
+		}
+	}
+	c.b1, c.b2 = newArcList(), newArcList()
+	c.p = 0
+}
+
+// 移除所有已过期的记录，返回移除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, l := range []*arcList{c.t1, c.t2} {
+		for ele := l.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.evict(l, ele)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// 将记录从缓存中彻底移除 (不进入幽灵队列)，并触发回调函数
+func (c *Cache) evict(l *arcList, ele *list.Element) {
+	e := l.remove(ele)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// 新增/修改缓存，永不过期
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 新增/修改缓存，并设置过期时间；ttl <= 0 表示永不过期
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	e := &entry{key: key, value: value, size: int64(len(key)) + int64(value.Len()), expire: expire}
+
+	// 已经在缓存中：更新值并视为一次命中，移动到 T2
+	for _, l := range []*arcList{c.t1, c.t2} {
+		if ele, ok := l.items[key]; ok {
+			l.remove(ele)
+			c.t2.pushFront(e)
+			c.replace(false)
+			return
+		}
+	}
+
+	// 命中幽灵队列 B1：说明 T1 的空间不够，增大 p
+	if ele, ok := c.b1.items[key]; ok {
+		c.p = min64(c.maxBytes, c.p+e.size*max64(c.b2.nbytes/max64(c.b1.nbytes, 1), 1))
+		c.b1.remove(ele)
+		c.t2.pushFront(e)
+		c.replace(false)
+		return
+	}
+
+	// 命中幽灵队列 B2：说明 T2 的空间不够，减小 p
+	if ele, ok := c.b2.items[key]; ok {
+		c.p = max64(0, c.p-e.size*max64(c.b1.nbytes/max64(c.b2.nbytes, 1), 1))
+		c.b2.remove(ele)
+		c.t2.pushFront(e)
+		c.replace(true)
+		return
+	}
+
+	// 完全未命中：添加到 T1
+	c.t1.pushFront(e)
+	c.replace(false)
+}
+
+// 超过了缓存允许使用的最大值时，根据 p 决定从 T1 还是 T2 中淘汰记录，被淘汰的key进入对应的幽灵队列
+// inB2 表示本次新增的key命中了 B2
+func (c *Cache) replace(inB2 bool) {
+	if c.maxBytes == 0 {
+		return
+	}
+
+	for c.t1.nbytes+c.t2.nbytes > c.maxBytes {
+		var from, ghost *arcList
+		if c.t1.nbytes > 0 && (c.t1.nbytes > c.p || (inB2 && c.t1.nbytes == c.p) || c.t2.nbytes == 0) {
+			from, ghost = c.t1, c.b1
+		} else {
+			from, ghost = c.t2, c.b2
+		}
+		e := from.removeBack()
+		ghost.pushFront(&entry{key: e.key, size: e.size})
+		if c.OnEvicted != nil {
+			c.OnEvicted(e.key, e.value)
+		}
+	}
+
+	// 限制幽灵队列的大小：T1+B1 不超过 maxBytes，四个队列的总和不超过 2*maxBytes
+	for c.b1.nbytes > 0 && c.t1.nbytes+c.b1.nbytes > c.maxBytes {
+		c.b1.removeBack()
+	}
+	for c.b2.nbytes > 0 && c.t1.nbytes+c.t2.nbytes+c.b1.nbytes+c.b2.nbytes > 2*c.maxBytes {
+		c.b2.removeBack()
+	}
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return c.t1.ll.Len() + c.t2.ll.Len()
+}
+
+// 当前已使用的字节数，不包括幽灵队列 (B1/B2 只记录key，不保存值)
+func (c *Cache) Bytes() int64 {
+	return c.t1.nbytes + c.t2.nbytes
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,111 @@
+package arc
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+type String string
+
+// 实现Value接口
+func (d String) Len() int {
+	return len(d)
+}
+
+// 测试添加和获取缓存
+func TestGet(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.Add("key1", String("123"))
+
+	v, ok := arc.Get("key1")
+	if !ok || string(v.(String)) != "123" {
+		t.Fatalf("cache hit key1=123 failed!")
+	}
+
+	if _, ok := arc.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed!")
+	}
+}
+
+// 测试当使用内存超过了设定值时，是否会触发记录的淘汰
+func TestRemoveoldest(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "key3"
+	v1, v2, v3 := "value1", "value2", "value3"
+
+	cap := len(k1 + v1 + k2 + v2)
+	arc := New(int64(cap), nil)
+	arc.Add(k1, String(v1))
+	arc.Add(k2, String(v2))
+	arc.Add(k3, String(v3))
+
+	_, ok := arc.Get(k1)
+	if ok || arc.Len() != 2 {
+		t.Fatalf("Removeoldest key[%s] failed!", k1)
+	}
+}
+
+// 测试回调函数能否被调用
+func TestOnEvicted(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+
+	arc := New(int64(10), callback)
+	arc.Add("key1", String("123456"))
+	arc.Add("k2", String("k2"))
+	arc.Add("k3", String("k3"))
+	arc.Add("k4", String("k4"))
+
+	expect := []string{"key1", "k2"}
+
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, but got keys is %s", expect, keys)
+	}
+}
+
+// 测试一次性的大范围扫描不会把经常访问的记录挤出缓存 (单纯的 LRU 做不到)
+func TestScanResistance(t *testing.T) {
+	arc := New(int64(40), nil)
+	arc.Add("hot1", String("v1"))
+	arc.Add("hot2", String("v2"))
+	arc.Get("hot1")
+	arc.Get("hot2")
+
+	for i := 0; i < 100; i++ {
+		arc.Add("scan"+strconv.Itoa(i), String("v"))
+	}
+
+	for _, k := range []string{"hot1", "hot2"} {
+		if _, ok := arc.Get(k); !ok {
+			t.Fatalf("hot key[%s] is evicted by scan", k)
+		}
+	}
+}
+
+// 测试移除指定缓存和清空缓存
+func TestRemoveAndPurge(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+
+	arc := New(int64(0), callback)
+	arc.Add("k1", String("v1"))
+	arc.Add("k2", String("v2"))
+	arc.Add("k3", String("v3"))
+
+	arc.Remove("k2")
+	if _, ok := arc.Get("k2"); ok || arc.Len() != 2 {
+		t.Fatalf("Remove key[k2] failed!")
+	}
+
+	arc.Purge()
+	if _, ok := arc.Get("k1"); ok || arc.Len() != 0 {
+		t.Fatalf("Purge failed!")
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expect OnEvicted to be called 3 times, but got %d", len(keys))
+	}
+}
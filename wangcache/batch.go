@@ -0,0 +1,161 @@
+package wangcache
+
+import (
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+//批量获取：一次获取多个key
+//先在当前节点的缓存中查找，未命中的key按负责的节点分组，
+//每个远程节点只需要一次请求 (PeerBatchGetter)，由当前节点负责的key并发地通过 load 加载 (同样经过 singleflight)
+
+// GetMulti 中每个key的结果
+type Result struct {
+	Value ByteView
+	Err   error
+}
+
+// GetMulti 获取多个key的缓存值，返回的结果与 keys 一一对应
+// 每个key的结果相互独立，某个key出错不影响其他key
+func (g *Group) GetMulti(keys []string) []Result {
+	return g.GetMultiContext(context.Background(), keys)
+}
+
+// GetMulti 的 context 版本，ctx 被取消或超时后，尚未完成的key返回 ctx 的错误
+func (g *Group) GetMultiContext(ctx context.Context, keys []string) []Result {
+	return g.getMulti(ctx, keys, true)
+}
+
+// GetMultiContext 的本地版本，所有未命中的key都在当前节点加载，用于处理其他节点转发过来的批量请求
+func (g *Group) GetMultiLocalContext(ctx context.Context, keys []string) []Result {
+	return g.getMulti(ctx, keys, false)
+}
+
+// route 为 false 时 (其他节点转发过来的请求) 所有未命中的key都在本地加载，不再路由到其他节点
+func (g *Group) getMulti(ctx context.Context, keys []string, route bool) []Result {
+	results := make([]Result, len(keys))
+
+	// 未命中缓存的key按负责的远程节点分组，值为key在 keys 中的下标
+	batches := make(map[PeerGetter][]int)
+	var local []int
+	for i, key := range keys {
+		if key == "" {
+			results[i].Err = fmt.Errorf("key is required")
+			continue
+		}
+		if val, ok, err := g.lookupCache(key); ok {
+			results[i] = Result{Value: val, Err: err}
+			continue
+		}
+		if !route {
+			local = append(local, i)
+		} else if peer := g.owner(key); peer != nil {
+			batches[peer] = append(batches[peer], i)
+		} else {
+			local = append(local, i)
+		}
+	}
+
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for peer, idx := range batches {
+		wg.Add(1)
+		go func(peer PeerGetter, idx []int) {
+			defer wg.Done()
+			g.getBatchFromPeer(ctx, peer, keys, idx, results)
+		}(peer, idx)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		g.loadEach(ctx, keys, local, results, route)
+	}()
+	wg.Wait()
+
+	return results
+}
+
+// 返回负责 key 的远程节点，为 nil 时由当前节点负责
+// 开启多副本时返回主节点，主节点失败后再由 load 依次尝试副本节点
+func (g *Group) owner(key string) PeerGetter {
+	peers, self := g.pickReplicas(key)
+	if len(peers) == 0 || self == 0 {
+		return nil
+	}
+	return peers[0]
+}
+
+// 一次请求从远程节点获取多个key
+// 节点不支持批量请求或者请求失败时，改为逐个 load；远程节点加载某个key出错时，该key也会重新 load
+func (g *Group) getBatchFromPeer(ctx context.Context, peer PeerGetter, keys []string, idx []int, results []Result) {
+	batch := make([]string, len(idx))
+	for j, i := range idx {
+		batch[j] = keys[i]
+	}
+
+	var responses []*pb.Response
+	var err error
+	switch p := peer.(type) {
+	case ContextPeerBatchGetter:
+		responses, err = p.GetBatchContext(ctx, g.name, batch)
+	case PeerBatchGetter:
+		responses, err = p.GetBatch(g.name, batch)
+	default:
+		g.loadEach(ctx, keys, idx, results, true)
+		return
+	}
+	if err != nil {
+		atomic.AddInt64(&g.stats.peerErrors, 1)
+		if ctx.Err() != nil {
+			for _, i := range idx {
+				results[i].Err = ctx.Err()
+			}
+			return
+		}
+		g.logger.Warn("failed to get keys from peer", "group", g.name, "self", g.self(), "keys", len(batch), "peer", peerName(peer), "error", err)
+		g.loadEach(ctx, keys, idx, results, true)
+		return
+	}
+
+	var failed []int
+	for j, i := range idx {
+		out := responses[j]
+		if err := responseError(out); err != nil {
+			// 远程节点已经确认数据源中不存在该key，无需再回源查询
+			if errors.Is(err, ErrNotFound) {
+				atomic.AddInt64(&g.stats.peerLoads, 1)
+				g.populateNegative(keys[i])
+				results[i].Err = fmt.Errorf("%w: %s", ErrNotFound, keys[i])
+				continue
+			}
+			atomic.AddInt64(&g.stats.peerErrors, 1)
+			failed = append(failed, i)
+			continue
+		}
+		atomic.AddInt64(&g.stats.peerLoads, 1)
+		value := g.viewFromResponse(out)
+		g.populatePeerValue(keys[i], value)
+		results[i].Value = value
+	}
+	g.loadEach(ctx, keys, failed, results, true)
+}
+
+// 并发地逐个加载key
+func (g *Group) loadEach(ctx context.Context, keys []string, idx []int, results []Result, route bool) {
+	var wg sync.WaitGroup
+	for _, i := range idx {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value, err := g.load(ctx, keys[i], route)
+			results[i] = Result{Value: value, Err: err}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,161 @@
+package wangcache
+
+import (
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// 按负责的节点把key分成两组
+func splitKeys(pool *HTTPPool, n int) (local, remote []string) {
+	for i := 0; i < n; i++ {
+		key := "key" + strconv.Itoa(i)
+		if _, ok := pool.PickPeer(key); ok {
+			remote = append(remote, key)
+		} else {
+			local = append(local, key)
+		}
+	}
+	return local, remote
+}
+
+func TestGetMulti(t *testing.T) {
+	var batches, gets int32
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/"+batchPath+"/") {
+			atomic.AddInt32(&gets, 1)
+			w.Write([]byte("remote"))
+			return
+		}
+		atomic.AddInt32(&batches, 1)
+		body, _ := ioutil.ReadAll(r.Body)
+		req := new(pb.BatchRequest)
+		if err := req.Unmarshal(body); err != nil {
+			t.Errorf("failed to decode batch request: %v", err)
+		}
+		res := &pb.BatchResponse{Version: pb.Version}
+		for _, key := range req.Keys {
+			out := &pb.Response{Version: pb.Version, Group: req.Group, Key: key, Value: []byte("remote-" + key)}
+			if key == "key0" || key == "key1" || key == "key2" {
+				out.Value, out.ErrorKind = nil, pb.ErrorKind_NOT_FOUND
+			}
+			res.Responses = append(res.Responses, out)
+		}
+		data, _ := res.Marshal()
+		w.Header().Set("Content-Type", pb.ContentType)
+		w.Write(data)
+	}))
+	defer remote.Close()
+
+	group := NewGroup("batch-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local-" + key), nil
+	}))
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", remote.URL)
+	group.RegisterPeers(pool)
+
+	local, remoteKeys := splitKeys(pool, 20)
+	if len(local) == 0 || len(remoteKeys) == 0 {
+		t.Fatalf("expect keys owned by both nodes, local: %v, remote: %v", local, remoteKeys)
+	}
+	keys := append(append([]string{""}, local...), remoteKeys...)
+
+	results := group.GetMulti(keys)
+	if len(results) != len(keys) {
+		t.Fatalf("expect %d results, but got %d", len(keys), len(results))
+	}
+	if results[0].Err == nil {
+		t.Fatalf("expect an error for empty key")
+	}
+	for i, key := range keys[1:] {
+		result := results[i+1]
+		switch {
+		case key == "key0" || key == "key1" || key == "key2":
+			if _, ok := pool.PickPeer(key); ok && !errors.Is(result.Err, ErrNotFound) {
+				t.Fatalf("expect ErrNotFound for %s, but got %v", key, result.Err)
+			}
+			if _, ok := pool.PickPeer(key); !ok && result.Value.String() != "local-"+key {
+				t.Fatalf("expect %s to be loaded locally, but got %q, err: %v", key, result.Value, result.Err)
+			}
+		case i < len(local):
+			if result.Err != nil || result.Value.String() != "local-"+key {
+				t.Fatalf("expect %s to be loaded locally, but got %q, err: %v", key, result.Value, result.Err)
+			}
+		default:
+			if result.Err != nil || result.Value.String() != "remote-"+key {
+				t.Fatalf("expect %s from remote peer, but got %q, err: %v", key, result.Value, result.Err)
+			}
+		}
+	}
+	// 所有远程的key只需要一次请求
+	if n := atomic.LoadInt32(&batches); n != 1 {
+		t.Fatalf("expect 1 batch request, but got %d", n)
+	}
+	if n := atomic.LoadInt32(&gets); n != 0 {
+		t.Fatalf("expect no single key request, but got %d", n)
+	}
+}
+
+func TestGetMultiFallback(t *testing.T) {
+	// 旧版本的节点不支持批量接口，逐个key请求
+	var gets int32
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/"+batchPath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&gets, 1)
+		w.Write([]byte("630"))
+	}))
+	defer remote.Close()
+
+	group := NewGroup("batch-fallback", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local-" + key), nil
+	}))
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", remote.URL)
+	group.RegisterPeers(pool)
+
+	_, keys := splitKeys(pool, 20)
+	for i, result := range group.GetMulti(keys) {
+		if result.Err != nil || result.Value.String() != "630" {
+			t.Fatalf("failed to get %s from remote peer, got %q, err: %v", keys[i], result.Value, result.Err)
+		}
+	}
+	if n := atomic.LoadInt32(&gets); int(n) != len(keys) {
+		t.Fatalf("expect %d single key requests, but got %d", len(keys), n)
+	}
+}
+
+func TestServeBatch(t *testing.T) {
+	group := NewGroup("batch-serve", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("key [%s]: %w", key, ErrNotFound)
+	}))
+	peer := newTestPeer(t, group)
+
+	keys := []string{"Tom", "unknown", "Jack"}
+	responses, err := peer.GetBatch("batch-serve", keys)
+	if err != nil {
+		t.Fatalf("failed to get batch, err: %v", err)
+	}
+	if string(responses[0].Value) != db["Tom"] || string(responses[2].Value) != db["Jack"] {
+		t.Fatalf("unexpected values: %q, %q", responses[0].Value, responses[2].Value)
+	}
+	if responses[1].ErrorKind != pb.ErrorKind_NOT_FOUND {
+		t.Fatalf("expect NOT_FOUND for unknown key, but got %v", responses[1].ErrorKind)
+	}
+
+	if _, err := peer.GetBatch("no-such-group", keys); err == nil {
+		t.Fatalf("expect an error for unknown group")
+	}
+}
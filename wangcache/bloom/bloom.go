@@ -0,0 +1,163 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+//实现布隆过滤器
+
+//布隆过滤器由一个长度为 m 的位数组和 k 个哈希函数组成。添加元素时，将 k 个哈希值对应的位都置为1；
+//查询元素时，只要有一位为0，则该元素一定不存在；若全部为1，则该元素"可能"存在。
+//所以布隆过滤器不会漏判(不存在假阴性)，只会以一定的概率误判(假阳性)，适合放在缓存前面拦截一定不存在的key，防止缓存穿透。
+
+// 序列化格式的版本号
+const version = 1
+
+// 序列化头部长度: 1字节版本号 + m、k、n 各8字节
+const headerLen = 1 + 8*3
+
+// Filter is a bloom filter. It is not safe for concurrent access.
+type Filter struct {
+	m    uint64   // 位数组的长度
+	k    uint64   // 哈希函数的个数
+	n    uint64   // 已添加的元素个数
+	bits []uint64 // 位数组
+}
+
+// 根据预计元素个数 n 和期望的误判率 fpRate 创建布隆过滤器，自动计算出最优的 m 和 k
+// m = -n*ln(p) / (ln2)^2   k = m/n * ln2
+func New(n uint64, fpRate float64) *Filter {
+	if n == 0 {
+		n = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	return NewWithSize(m, k)
+}
+
+// 直接指定位数组长度 m 和哈希函数个数 k 创建布隆过滤器
+func NewWithSize(m, k uint64) *Filter {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &Filter{
+		m:    m,
+		k:    k,
+		bits: make([]uint64, (m+63)/64),
+	}
+}
+
+// 采用双重哈希 (double hashing) 模拟 k 个哈希函数: h(i) = h1 + i*h2
+func (f *Filter) locations(key string) (h1, h2 uint64) {
+	a := fnv.New64a()
+	a.Write([]byte(key))
+	b := fnv.New64()
+	b.Write([]byte(key))
+	// h2 必须为奇数，保证 k 个位置不会退化成同一个
+	return a.Sum64(), b.Sum64() | 1
+}
+
+// 添加元素
+func (f *Filter) Add(key string) {
+	h1, h2 := f.locations(key)
+	for i := uint64(0); i < f.k; i++ {
+		loc := (h1 + i*h2) % f.m
+		f.bits[loc/64] |= 1 << (loc % 64)
+	}
+	f.n++
+}
+
+// 判断元素是否可能存在；返回 false 时元素一定不存在
+func (f *Filter) Test(key string) bool {
+	h1, h2 := f.locations(key)
+	for i := uint64(0); i < f.k; i++ {
+		loc := (h1 + i*h2) % f.m
+		if f.bits[loc/64]&(1<<(loc%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 从迭代器中批量添加元素，next 返回 false 时结束，返回添加的元素个数
+// 一般在启动时遍历数据源中所有的key进行预热
+func (f *Filter) Seed(next func() (key string, ok bool)) int {
+	count := 0
+	for {
+		key, ok := next()
+		if !ok {
+			return count
+		}
+		f.Add(key)
+		count++
+	}
+}
+
+// 将另一个参数相同的布隆过滤器合并进来 (按位或)，合并后两者中添加过的元素都会被判定为可能存在
+func (f *Filter) Merge(other *Filter) error {
+	if f.m != other.m || f.k != other.k {
+		return fmt.Errorf("bloom: cannot merge filter(m=%d, k=%d) into filter(m=%d, k=%d)", other.m, other.k, f.m, f.k)
+	}
+	for i := range f.bits {
+		f.bits[i] |= other.bits[i]
+	}
+	f.n += other.n
+	return nil
+}
+
+// 已添加的元素个数 (合并后为近似值)
+func (f *Filter) Count() uint64 {
+	return f.n
+}
+
+// 根据当前已添加的元素个数估算误判率: (1 - e^(-kn/m))^k
+func (f *Filter) FalsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.n)/float64(f.m)), float64(f.k))
+}
+
+// 序列化，便于在节点之间传输 (实现 encoding.BinaryMarshaler 接口)
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, headerLen+8*len(f.bits))
+	data[0] = version
+	binary.BigEndian.PutUint64(data[1:], f.m)
+	binary.BigEndian.PutUint64(data[9:], f.k)
+	binary.BigEndian.PutUint64(data[17:], f.n)
+	for i, w := range f.bits {
+		binary.BigEndian.PutUint64(data[headerLen+8*i:], w)
+	}
+	return data, nil
+}
+
+// 反序列化 (实现 encoding.BinaryUnmarshaler 接口)
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < headerLen {
+		return errors.New("bloom: data too short")
+	}
+	if data[0] != version {
+		return fmt.Errorf("bloom: unsupported version %d", data[0])
+	}
+	m := binary.BigEndian.Uint64(data[1:])
+	k := binary.BigEndian.Uint64(data[9:])
+	n := binary.BigEndian.Uint64(data[17:])
+	words := (m + 63) / 64
+	if m == 0 || k == 0 || uint64(len(data)-headerLen) != 8*words {
+		return errors.New("bloom: corrupted data")
+	}
+
+	bits := make([]uint64, words)
+	for i := range bits {
+		bits[i] = binary.BigEndian.Uint64(data[headerLen+8*i:])
+	}
+	f.m, f.k, f.n, f.bits = m, k, n, bits
+	return nil
+}
@@ -0,0 +1,105 @@
+package bloom
+
+import (
+	"strconv"
+	"testing"
+)
+
+// 测试添加过的元素一定能被查到 (不存在假阴性)
+func TestAddAndTest(t *testing.T) {
+	f := New(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add("key" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.Test("key" + strconv.Itoa(i)) {
+			t.Fatalf("key%d was added but not found", i)
+		}
+	}
+	if f.Count() != 1000 {
+		t.Fatalf("expect count 1000, but got %d", f.Count())
+	}
+}
+
+// 测试误判率是否在期望范围内
+func TestFalsePositiveRate(t *testing.T) {
+	n, rate := 10000, 0.01
+	f := New(uint64(n), rate)
+	for i := 0; i < n; i++ {
+		f.Add("key" + strconv.Itoa(i))
+	}
+
+	fp := 0
+	for i := 0; i < n; i++ {
+		if f.Test("other" + strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	if got := float64(fp) / float64(n); got > 2*rate {
+		t.Fatalf("false positive rate %f is far beyond %f", got, rate)
+	}
+}
+
+// 测试通过迭代器批量添加
+func TestSeed(t *testing.T) {
+	keys := []string{"Tom", "Jack", "Sam"}
+	f := New(100, 0.01)
+	i := 0
+	n := f.Seed(func() (string, bool) {
+		if i == len(keys) {
+			return "", false
+		}
+		i++
+		return keys[i-1], true
+	})
+	if n != len(keys) {
+		t.Fatalf("expect %d keys seeded, but got %d", len(keys), n)
+	}
+	for _, k := range keys {
+		if !f.Test(k) {
+			t.Fatalf("%s was seeded but not found", k)
+		}
+	}
+}
+
+// 测试序列化与反序列化
+func TestMarshal(t *testing.T) {
+	f := New(100, 0.01)
+	f.Add("Tom")
+	f.Add("Jack")
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g Filter
+	if err := g.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !g.Test("Tom") || !g.Test("Jack") || g.Count() != 2 {
+		t.Fatalf("unmarshaled filter lost data")
+	}
+
+	if err := g.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Fatalf("expect error for corrupted data")
+	}
+}
+
+// 测试合并
+func TestMerge(t *testing.T) {
+	a, b := New(100, 0.01), New(100, 0.01)
+	a.Add("Tom")
+	b.Add("Jack")
+
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Test("Tom") || !a.Test("Jack") {
+		t.Fatalf("merged filter should contain both Tom and Jack")
+	}
+
+	if err := a.Merge(New(1000, 0.01)); err == nil {
+		t.Fatalf("expect error when merging filters with different size")
+	}
+}
@@ -1,10 +1,18 @@
 package wangcache
 
+import "time"
+
 //缓存值的抽象与封装
 
 //抽象出一个只读数据结构 ByteView 用来表示缓存值
 type ByteView struct {
 	b []byte  // 存储真实的缓存值；选择byte类型是为了能够支持任意的数据类型的存储，例如字符串、图片等。
+	e time.Time  // 过期时间，零值表示永不过期
+}
+
+// Expire returns the view's expire time, the zero time means never expire.
+func (v ByteView) Expire() time.Time {
+	return v.e
 }
 
 // Len returns the view's length (实现lru中的Value接口)
@@ -1,42 +1,183 @@
 package wangcache
 
 import (
+	"7go/wangCache/wangcache/arc"
+	"7go/wangCache/wangcache/fifo"
+	"7go/wangCache/wangcache/lfu"
 	"7go/wangCache/wangcache/lru"
+	"7go/wangCache/wangcache/policy"
+	"7go/wangCache/wangcache/tinylfu"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 //缓存雪崩：缓存在同一时刻全部失效，造成瞬时DB请求量大、压力骤增，引起雪崩。缓存雪崩通常因为缓存服务器宕机、缓存的 key 设置了相同的过期时间等引起。
 //缓存击穿：一个存在的key，在缓存过期的一刻，同时有大量的请求，这些请求都会击穿到 DB ，造成瞬时DB请求量大、压力骤增。
 //缓存穿透：查询一个不存在的数据，因为不存在则不会写到缓存中，所以每次都会去请求 DB，如果瞬间流量过大，穿透到 DB，导致宕机。
 
+// 缓存淘汰策略
+type EvictionPolicy int
+
+const (
+	LRU     EvictionPolicy = iota  // 最近最少使用，默认策略
+	LFU                            // 最不经常使用
+	FIFO                           // 先进先出
+	ARC                            // 自适应替换缓存
+	TinyLFU                        // W-TinyLFU
+)
+
+// 根据淘汰策略创建对应的缓存实例
+func newPolicyCache(p EvictionPolicy, maxBytes int64, onEvicted func(string, policy.Value)) policy.Cache {
+	switch p {
+	case LFU:
+		return lfu.New(maxBytes, onEvicted)
+	case FIFO:
+		return fifo.New(maxBytes, onEvicted)
+	case ARC:
+		return arc.New(maxBytes, onEvicted)
+	case TinyLFU:
+		return tinylfu.New(maxBytes, onEvicted)
+	default:
+		return lru.New(maxBytes, onEvicted)
+	}
+}
+
 type cache struct {
 	mu         sync.Mutex  // 通过sync互斥锁实现并发控制
-	lru       *lru.Cache
+	evictor    policy.Cache  // 具体淘汰策略的实现，第一次添加缓存时才创建 (延迟初始化)
+	policy     EvictionPolicy
 	cacheBytes int64       // 最大使用内存字节数
+	stop       chan struct{}  // 用于停止后台清理过期缓存的goroutine
+	evictions  int64       // 因容量不足或过期被移除的记录数，不包括主动删除的记录
+	removing   bool        // 正在主动删除 (remove/purge)，此时移除的记录不计入 evictions
+	disabled   bool        // 为 true 时不保存任何值，用于分配到的内存为0的缓存 (cacheBytes 为0表示不限制)
 }
 
+// 添加缓存，过期时间由 value.Expire() 决定
 func (c *cache) add(key string, value ByteView) {
+	if c.disabled {
+		return
+	}
+	var ttl time.Duration
+	if !value.e.IsZero() {
+		ttl = time.Until(value.e)
+		// 已经过期的值不需要再缓存
+		if ttl <= 0 {
+			return
+		}
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	if c.evictor == nil {
+		c.evictor = newPolicyCache(c.policy, c.cacheBytes, c.onEvicted)
 	}
 
-	c.lru.Add(key, value)
+	c.evictor.AddWithTTL(key, value, ttl)
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.lru == nil {
+	if c.evictor == nil {
 		return
 	}
 
-	val, ok := c.lru.Get(key)
+	val, ok := c.evictor.Get(key)
 	if ok {
 		return val.(ByteView), ok
 	}
 	return
-}
\ No newline at end of file
+}
+
+// 移除指定的缓存
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.evictor != nil {
+		c.removing = true
+		c.evictor.Remove(key)
+		c.removing = false
+	}
+}
+
+// 清空所有缓存
+func (c *cache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.evictor != nil {
+		c.removing = true
+		c.evictor.Purge()
+		c.removing = false
+	}
+}
+
+// 记录被淘汰算法移除时的回调，调用时已经持有 c.mu
+func (c *cache) onEvicted(key string, value policy.Value) {
+	if !c.removing {
+		atomic.AddInt64(&c.evictions, 1)
+	}
+}
+
+// 返回缓存中的记录数、占用的字节数，以及累计淘汰的记录数
+func (c *cache) stats() (items, bytes, evictions int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.evictor != nil {
+		items, bytes = int64(c.evictor.Len()), c.evictor.Bytes()
+	}
+	return items, bytes, atomic.LoadInt64(&c.evictions)
+}
+
+// 清理所有已过期的缓存
+func (c *cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.evictor == nil {
+		return 0
+	}
+	return c.evictor.RemoveExpired()
+}
+
+// 启动后台goroutine，每隔 interval 清理一次过期缓存
+// 惰性过期只能清理被访问到的key，从不被访问的过期key需要靠它来释放内存
+func (c *cache) startReaper(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		return
+	}
+	c.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.removeExpired()
+			case <-stop:
+				return
+			}
+		}
+	}(c.stop)
+}
+
+// 停止后台清理goroutine
+func (c *cache) stopReaper() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
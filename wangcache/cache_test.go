@@ -0,0 +1,71 @@
+package wangcache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	s := newShardedCache(4, 1<<10+3, LRU)
+
+	total := int64(0)
+	for _, c := range s.shards {
+		total += c.cacheBytes
+	}
+	if total != 1<<10+3 {
+		t.Fatalf("expect cacheBytes to be split across shards, but got %d in total", total)
+	}
+
+	for k, v := range db {
+		s.add(k, ByteView{b: []byte(v)})
+	}
+	for k, v := range db {
+		if view, ok := s.get(k); !ok || view.String() != v {
+			t.Fatalf("failed to get value of %s from sharded cache", k)
+		}
+	}
+	if _, ok := s.get("unknown"); ok {
+		t.Fatalf("unknown should not be in the sharded cache")
+	}
+
+	// cacheBytes 少于分片数量时，每个分片仍然有大小限制
+	small := newStore(3, LRU, 4)
+	for i := 0; i < 100; i++ {
+		small.add("key" + strconv.Itoa(i), ByteView{b: []byte("v")})
+	}
+	if _, bytes, _ := small.stats(); bytes > 3 {
+		t.Fatalf("expect at most 3 bytes in the store, but got %d", bytes)
+	}
+}
+
+// 并发 Get 的基准测试，对比单锁的 cache 与分片的 shardedCache
+// go test -bench=Get -cpu=1,4,8
+
+const benchKeys = 1024
+
+func benchmarkStoreGet(b *testing.B, s store) {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		s.add(keys[i], ByteView{b: []byte("value")})
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		// 每个goroutine从随机的位置开始访问，避免所有goroutine同时访问同一个分片
+		i := rand.Intn(benchKeys)
+		for pb.Next() {
+			s.get(keys[i%benchKeys])
+			i++
+		}
+	})
+}
+
+func BenchmarkCacheGet(b *testing.B) {
+	benchmarkStoreGet(b, newStore(0, LRU, 1))
+}
+
+func BenchmarkShardedCacheGet(b *testing.B) {
+	benchmarkStoreGet(b, newStore(0, LRU, 32))
+}
@@ -0,0 +1,97 @@
+package wangcache
+
+import (
+	"7go/wangCache/wangcache/singleflight"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+//合并回源：把短时间内并发未命中的key合并成一次 BatchGetter.GetMulti 调用
+//每个key仍然先经过 singleflight，同一个key在同一时刻只会出现在一个批次中，
+//batchLoader 只负责把不同的key攒成一批
+//一次批量调用由多个请求共享，所以不会因为其中某个请求被取消而取消，被取消的请求只是不再等待结果
+//GetMulti 在单独的 goroutine 中执行，发生 panic 时由批次中的每个请求重新 panic，与普通 Getter 的行为一致
+
+const (
+	defaultBatchWindow = 2 * time.Millisecond
+	defaultBatchSize   = 128
+)
+
+type batchLoader struct {
+	getter BatchGetter
+	window time.Duration // 第一个key到达后最多等待的时间
+	size   int           // 每批最多的key数量，<= 0 表示不限制
+
+	mu      sync.Mutex
+	pending *batch // 正在攒的批次
+}
+
+// 一次批量调用
+type batch struct {
+	keys   []string
+	done   chan struct{} // 调用结束后关闭
+	values map[string][]byte
+	err    error
+}
+
+// 把key加入当前批次，等待批量调用结束后返回该key的结果
+func (l *batchLoader) get(ctx context.Context, key string) ([]byte, error) {
+	l.mu.Lock()
+	b := l.pending
+	if b == nil {
+		b = &batch{done: make(chan struct{})}
+		l.pending = b
+		time.AfterFunc(l.window, func() { l.flush(b) })
+	}
+	b.keys = append(b.keys, key)
+	if l.size > 0 && len(b.keys) >= l.size {
+		// 批次已满，立即调用，不再等待时间窗口结束；之后的key加入新的批次
+		l.pending = nil
+		go l.run(b)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if e, ok := b.err.(*singleflight.PanicError); ok {
+		panic(e)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if value, ok := b.values[key]; ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+}
+
+// 时间窗口结束，批次已经因为满了而被调用过时直接返回
+func (l *batchLoader) flush(b *batch) {
+	l.mu.Lock()
+	if l.pending != b {
+		l.mu.Unlock()
+		return
+	}
+	l.pending = nil
+	l.mu.Unlock()
+
+	l.run(b)
+}
+
+// 发起批量调用，每个批次只会执行一次
+// GetMulti 发生 panic 时记录到 b.err 中，不会让整个进程崩溃，也不会让等待者一直阻塞
+func (l *batchLoader) run(b *batch) {
+	defer close(b.done)
+	defer func() {
+		if r := recover(); r != nil {
+			b.values, b.err = nil, &singleflight.PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	b.values, b.err = l.getter.GetMulti(b.keys)
+}
@@ -0,0 +1,139 @@
+package wangcache
+
+import (
+	"7go/wangCache/wangcache/singleflight"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录每次批量调用的key
+type recordingBatchGetter struct {
+	mu    sync.Mutex
+	calls [][]string
+	err   error
+}
+
+func (r *recordingBatchGetter) getter() BatchGetterFunc {
+	return func(keys []string) (map[string][]byte, error) {
+		r.mu.Lock()
+		r.calls = append(r.calls, append([]string(nil), keys...))
+		r.mu.Unlock()
+		if r.err != nil {
+			return nil, r.err
+		}
+		values := make(map[string][]byte)
+		for _, key := range keys {
+			if key != "unknown" {
+				values[key] = []byte("v-" + key)
+			}
+		}
+		return values, nil
+	}
+}
+
+func newBatchGroup(name string, getter Getter, opts ...GroupOption) *Group {
+	group := NewGroup(name, 2<<10, getter, opts...)
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self")
+	group.RegisterPeers(pool)
+	return group
+}
+
+func TestBatchGetterCoalesce(t *testing.T) {
+	r := &recordingBatchGetter{}
+	group := newBatchGroup("coalesce", r.getter(), WithBatchWindow(50*time.Millisecond, 100))
+
+	// 10 个不同的key，每个key并发请求 3 次
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if view, err := group.Get(key); err != nil || view.String() != "v-"+key {
+				t.Errorf("failed to get %s, got %q, err: %v", key, view, err)
+			}
+		}("key" + strconv.Itoa(i%10))
+	}
+	wg.Wait()
+
+	if len(r.calls) != 1 {
+		t.Fatalf("expect 1 batch call, but got %d: %v", len(r.calls), r.calls)
+	}
+	keys := r.calls[0]
+	sort.Strings(keys)
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			t.Fatalf("key %s is loaded more than once: %v", keys[i], keys)
+		}
+	}
+	if len(keys) != 10 {
+		t.Fatalf("expect 10 keys in batch, but got %v", keys)
+	}
+}
+
+func TestBatchGetterSize(t *testing.T) {
+	r := &recordingBatchGetter{}
+	group := newBatchGroup("coalesce-size", r.getter(), WithBatchWindow(time.Hour, 3))
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	for i, result := range group.GetMulti(keys) {
+		if result.Err != nil || result.Value.String() != "v-"+keys[i] {
+			t.Fatalf("failed to get %s, got %q, err: %v", keys[i], result.Value, result.Err)
+		}
+	}
+	// 批次满了立即调用，不会等待一个小时
+	if len(r.calls) != 2 {
+		t.Fatalf("expect 2 batch calls, but got %v", r.calls)
+	}
+}
+
+func TestBatchGetterErrors(t *testing.T) {
+	r := &recordingBatchGetter{}
+	group := newBatchGroup("coalesce-errors", r.getter())
+
+	if _, err := group.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound for key missing from result, but got %v", err)
+	}
+
+	r.err = errors.New("db is down")
+	for _, result := range group.GetMulti([]string{"x", "y"}) {
+		if !errors.Is(result.Err, r.err) {
+			t.Fatalf("expect batch error, but got %v", result.Err)
+		}
+	}
+
+	// 不合并时逐个调用
+	r = &recordingBatchGetter{}
+	group = newBatchGroup("coalesce-disabled", r.getter(), WithBatchWindow(0, 0))
+	group.GetMulti([]string{"x", "y"})
+	if len(r.calls) != 2 {
+		t.Fatalf("expect 2 single key calls, but got %v", r.calls)
+	}
+}
+
+func TestBatchGetterPanic(t *testing.T) {
+	group := newBatchGroup("coalesce-panic", BatchGetterFunc(func(keys []string) (map[string][]byte, error) {
+		panic("boom")
+	}))
+
+	// 同一批次中的每个请求都会收到 panic，进程不会崩溃
+	var wg sync.WaitGroup
+	for _, key := range []string{"Tom", "Jack"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer func() {
+				e, ok := recover().(*singleflight.PanicError)
+				if !ok || e.Value != "boom" {
+					t.Errorf("expect PanicError with boom for %s, but got %#v", key, e)
+				}
+			}()
+			group.Get(key)
+		}(key)
+	}
+	wg.Wait()
+}
@@ -1,8 +1,8 @@
 package consistenthash
 
 import (
+	"7go/wangCache/wangcache/logger"
 	"hash/crc32"
-	"log"
 	"sort"
 	"strconv"
 )
@@ -19,15 +19,25 @@ type Hash func(data []byte) uint32
 type Map struct {
 	hash     Hash   // Hash函数
 	replicas int    // 虚拟节点倍数 (即一个真实节点对应哈希环上几个虚拟节点)
-	keys     []int  // 哈希环, sorted
+	keys     []int  // 哈希环, sorted，每个哈希值只出现一次
 	hashMap  map[int]string  // 虚拟节点与真实节点的映射表 (键是虚拟节点的哈希值，值是真实节点的名称)
+	claims   map[int][]string  // 每个哈希值上的所有虚拟节点所属的真实节点，多于一个时说明发生了碰撞
+	weights  map[string]int  // 真实节点的权重，节点的虚拟节点数量为 replicas * weight
+	logger   logger.Logger   // 默认不输出日志
 }
 
+//不同的虚拟节点可能得到相同的哈希值 (哈希碰撞，或者像 "1"+"2x" 与 "12"+"x" 这样拼接后相同的名称)，
+//这时哈希环上只保留一个哈希值，它属于名称最小的节点，结果与节点的添加顺序无关；
+//claims 记录了所有声明该哈希值的节点，其中一个节点被移除后，由剩下的节点接管
+
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		hash:     fn,
 		replicas: replicas,
 		hashMap:  make(map[int]string),
+		claims:   make(map[int][]string),
+		weights:  make(map[string]int),
+		logger:   logger.Nop,
 	}
 	if m.hash == nil {
 		// 默认使用 crc32.ChecksumIEEE算法
@@ -36,48 +46,122 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
+// 设置输出日志的 Logger，选择节点时输出 Debug 级别的日志
+// 实现logger.Setter接口
+func (m *Map) SetLogger(l logger.Logger) {
+	m.logger = l
+}
+
 // 添加真实节点/机器
 // 参数为 真实节点的名称
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		// 为每个真实节点生成对应数量的虚拟节点
-		for i := 0; i < m.replicas; i++ {
-			// 根据Hash算法计算出虚拟节点的哈希值
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			// 将虚拟节点的hash值添加到哈希环上
+		m.AddWeighted(key, 1)
+	}
+}
+
+// 添加带权重的真实节点，节点的虚拟节点数量为 replicas * weight，分配到的key的数量与权重成正比
+// 比如内存为其他机器两倍的节点，可以设置权重为2。weight < 1 时按1处理
+// 节点已经存在时会按新的权重重新添加
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	if _, ok := m.weights[key]; ok {
+		m.Remove(key)
+	}
+	m.weights[key] = weight
+
+	// 为真实节点生成对应数量的虚拟节点
+	for i := 0; i < m.replicas * weight; i++ {
+		// 根据Hash算法计算出虚拟节点的哈希值
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		// 将虚拟节点的hash值添加到哈希环上，已经存在的哈希值不再重复添加
+		if len(m.claims[hash]) == 0 {
 			m.keys = append(m.keys, hash)
-			// 设置真实节点与虚拟节点的映射关系
-			m.hashMap[hash] = key
 		}
+		m.claims[hash] = append(m.claims[hash], key)
+		// 设置真实节点与虚拟节点的映射关系
+		m.hashMap[hash] = owner(m.claims[hash])
 	}
 
 	// 对哈希环进行排序，保证哈希环是有序的
 	sort.Ints(m.keys)
 }
 
-// 移除节点/机器
+// 移除节点/机器，按添加时的权重移除所有的虚拟节点，不存在的节点会被忽略
 func (m *Map) Remove(key string) {
-	for i := 0; i < m.replicas; i++ {
+	weight, ok := m.weights[key]
+	if !ok {
+		return
+	}
+	delete(m.weights, key)
+
+	removed := false
+	for i := 0; i < m.replicas * weight; i++ {
 		// 根据Hash算法计算出虚拟节点的哈希值
 		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
 
-		// 从哈希环上寻找hash值对应的下标
-		idx := sort.SearchInts(m.keys, hash)
-		// 从哈希环上移除idx下标对应的哈希值
-		m.keys = append(m.keys[:idx], m.keys[idx+1:]...)
+		// 移除该节点对这个哈希值的一次声明
+		claims := m.claims[hash]
+		for j, node := range claims {
+			if node == key {
+				claims = append(claims[:j], claims[j+1:]...)
+				break
+			}
+		}
 
-		// 从m.hashMap中移除虚拟节点与真实节点的映射关系
+		if len(claims) > 0 {
+			// 发生过碰撞，由剩下的节点接管这个哈希值
+			m.claims[hash] = claims
+			m.hashMap[hash] = owner(claims)
+			continue
+		}
+		// 从m.hashMap中移除虚拟节点与真实节点的映射关系，哈希环上的值在最后统一移除
+		delete(m.claims, hash)
 		delete(m.hashMap, hash)
+		removed = true
+	}
+
+	if removed {
+		// 只保留仍然有节点声明的哈希值，哈希环仍然是有序的
+		keys := m.keys[:0]
+		for _, hash := range m.keys {
+			if _, ok := m.hashMap[hash]; ok {
+				keys = append(keys, hash)
+			}
+		}
+		m.keys = keys
 	}
 }
 
+// 返回所有的真实节点，按名称排序
+func (m *Map) Nodes() []string {
+	nodes := make([]string, 0, len(m.weights))
+	for node := range m.weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// 碰撞时哈希值属于名称最小的节点
+func owner(claims []string) string {
+	min := claims[0]
+	for _, node := range claims[1:] {
+		if node < min {
+			min = node
+		}
+	}
+	return min
+}
+
 // 选择节点
 func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
 		return ""
 	}
 
-	log.Printf("select node ... key = %s\n", key)
 	// 计算出key的哈希值
 	hash := int(m.hash([]byte(key)))
 	// 顺时针找到第一个匹配的虚拟节点的下标 idx
@@ -88,5 +172,33 @@ func (m *Map) Get(key string) string {
 	// 获取下标对应的虚拟节点的哈希值，m.keys是哈希环，属于首尾相连的环状结构，所以使用取余数的方式来避免下标越界
 	vHash := m.keys[idx % len(m.keys)]
 	// 从hashMap中获取虚拟节点对应的真实节点
-	return m.hashMap[vHash]
+	node := m.hashMap[vHash]
+	m.logger.Debug("select node", "key", key, "node", node)
+	return node
+}
+
+// 选择 key 对应的 n 个不同的真实节点，用于多副本存储
+// 第一个节点与 Get 的结果相同 (主节点)，其余为哈希环上顺时针方向遇到的其他真实节点 (副本节点)
+// 真实节点的数量少于 n 时返回所有的真实节点
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	// 从 idx 开始顺时针遍历哈希环，跳过属于同一个真实节点的虚拟节点，最多遍历一圈
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx + i) % len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
 }
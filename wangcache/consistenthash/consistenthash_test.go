@@ -1,8 +1,14 @@
 package consistenthash
 
 import (
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"reflect"
+	"sort"
 	"strconv"
 	"testing"
+	"testing/quick"
 )
 
 func TestHashing(t *testing.T)  {
@@ -41,4 +47,223 @@ func TestHashing(t *testing.T)  {
 			t.Errorf("Asking for %s, should have yielded %s", k, v)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+
+	// 哈希环: 2 4 6 12 14 16 22 24 26
+	hash.Add("6", "4", "2")
+
+	testCases := []struct {
+		key   string
+		n     int
+		nodes []string
+	}{
+		{"2", 2, []string{"2", "4"}},
+		{"11", 3, []string{"2", "4", "6"}},
+		{"23", 2, []string{"4", "6"}},
+		{"27", 5, []string{"2", "4", "6"}}, // 只有3个真实节点
+		{"15", 1, []string{"6"}},
+		{"15", 0, nil},
+	}
+
+	for _, c := range testCases {
+		nodes := hash.GetN(c.key, c.n)
+		if !reflect.DeepEqual(nodes, c.nodes) {
+			t.Errorf("Asking for %d nodes of %s, should have yielded %v, but got %v", c.n, c.key, c.nodes, nodes)
+		}
+		if len(nodes) > 0 && nodes[0] != hash.Get(c.key) {
+			t.Errorf("The first node of %s should be the same as Get", c.key)
+		}
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(2, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+
+	// "2" 的权重为2，生成 2*2 个虚拟节点： 2 12 22 32
+	// "4" 的权重为1，生成 2 个虚拟节点： 4 14
+	hash.AddWeighted("2", 2)
+	hash.Add("4")
+	if !reflect.DeepEqual(hash.keys, []int{2, 4, 12, 14, 22, 32}) {
+		t.Fatalf("unexpected ring %v", hash.keys)
+	}
+	if hash.Get("30") != "2" || hash.Get("13") != "4" {
+		t.Errorf("unexpected nodes for 30 and 13")
+	}
+
+	// 修改权重后重新添加，移除时按添加时的权重移除所有的虚拟节点
+	hash.AddWeighted("4", 2)
+	if !reflect.DeepEqual(hash.keys, []int{2, 4, 12, 14, 22, 24, 32, 34}) {
+		t.Fatalf("unexpected ring %v after changing weight", hash.keys)
+	}
+	hash.Remove("2")
+	hash.Remove("2")
+	if !reflect.DeepEqual(hash.keys, []int{4, 14, 24, 34}) || len(hash.hashMap) != 4 {
+		t.Fatalf("unexpected ring %v after removing weighted node", hash.keys)
+	}
+}
+
+func TestWeightedDistribution(t *testing.T) {
+	// crc32 是线性的，名称长度相同的节点的虚拟节点分布有规律，这里使用 FNV 以便观察权重的效果
+	hash := New(50, func(data []byte) uint32 {
+		h := fnv.New32a()
+		h.Write(data)
+		return h.Sum32()
+	})
+	hash.AddWeighted("http://localhost:8001", 3)
+	hash.Add("http://localhost:8002")
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[hash.Get("key" + strconv.Itoa(i))]++
+	}
+	// 理想情况下权重为3的节点分配到 3/4 的key
+	if ratio := float64(counts["http://localhost:8001"]) / 10000; ratio < 0.65 || ratio > 0.85 {
+		t.Errorf("expect about 75%% keys on http://localhost:8001, but got %.2f", ratio)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// 只有4个哈希值，所有节点的虚拟节点都会发生碰撞
+	hash := func(key []byte) uint32 {
+		return crc32.ChecksumIEEE(key) % 4
+	}
+	a, b := New(8, hash), New(8, hash)
+	a.Add("x", "y", "z")
+	b.Add("z", "y", "x")
+
+	// 碰撞时哈希值属于名称最小的节点，与添加顺序无关
+	if !reflect.DeepEqual(a.keys, b.keys) || !reflect.DeepEqual(a.hashMap, b.hashMap) {
+		t.Fatalf("expect the same ring regardless of the order of adding nodes")
+	}
+	for _, h := range a.keys {
+		if a.hashMap[h] != "x" {
+			t.Fatalf("expect x to own hash %d, but got %s", h, a.hashMap[h])
+		}
+	}
+
+	// 移除拥有哈希值的节点后，由其他发生碰撞的节点接管
+	a.Remove("x")
+	if got := a.Get("Tom"); got != "y" {
+		t.Fatalf("expect y to take over after removing x, but got %s", got)
+	}
+	a.Remove("y")
+	a.Remove("y")
+	a.Remove("unknown")
+	if got := a.Get("Tom"); got != "z" || !reflect.DeepEqual(a.Nodes(), []string{"z"}) {
+		t.Fatalf("expect only z left, but got %s %v", got, a.Nodes())
+	}
+	a.Remove("z")
+	if a.Get("Tom") != "" || len(a.keys) != 0 || len(a.hashMap) != 0 || len(a.claims) != 0 {
+		t.Fatalf("expect an empty ring after removing all nodes")
+	}
+}
+
+// 随机的添加/移除操作
+type ringOp struct {
+	Node   uint8
+	Weight uint8
+	Remove bool
+}
+
+// 检查哈希环的不变量
+func checkRing(m *Map, model map[string]int) error {
+	for i := 1; i < len(m.keys); i++ {
+		if m.keys[i-1] >= m.keys[i] {
+			return fmt.Errorf("ring is not strictly increasing at %d: %v", i, m.keys)
+		}
+	}
+	if len(m.keys) != len(m.hashMap) || len(m.keys) != len(m.claims) {
+		return fmt.Errorf("ring has %d keys, %d mappings and %d claims", len(m.keys), len(m.hashMap), len(m.claims))
+	}
+
+	claims := 0
+	for _, h := range m.keys {
+		owners, ok := m.claims[h]
+		if !ok || len(owners) == 0 {
+			return fmt.Errorf("hash %d on ring has no claim", h)
+		}
+		if m.hashMap[h] != owner(owners) {
+			return fmt.Errorf("hash %d is owned by %s, but claimed by %v", h, m.hashMap[h], owners)
+		}
+		for _, node := range owners {
+			if _, ok := model[node]; !ok {
+				return fmt.Errorf("hash %d is claimed by removed node %s", h, node)
+			}
+		}
+		claims += len(owners)
+	}
+
+	expect := 0
+	nodes := make([]string, 0, len(model))
+	for node, weight := range model {
+		expect += m.replicas * weight
+		nodes = append(nodes, node)
+	}
+	if claims != expect {
+		return fmt.Errorf("expect %d virtual nodes, but got %d", expect, claims)
+	}
+	sort.Strings(nodes)
+	if !reflect.DeepEqual(m.Nodes(), nodes) {
+		return fmt.Errorf("expect nodes %v, but got %v", nodes, m.Nodes())
+	}
+
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if got := m.Get(key); (got == "") != (len(model) == 0) || (got != "" && model[got] == 0) {
+			return fmt.Errorf("Get(%s) returned unexpected node %q", key, got)
+		}
+	}
+	return nil
+}
+
+func TestRingInvariants(t *testing.T) {
+	// 哈希值空间很小，保证频繁地发生碰撞
+	hash := func(key []byte) uint32 {
+		return crc32.ChecksumIEEE(key) % 97
+	}
+	names := []string{"a", "b", "1a", "12", "2", "http://localhost:8001"}
+
+	property := func(ops []ringOp) bool {
+		m := New(5, hash)
+		model := make(map[string]int)
+		for _, op := range ops {
+			node := names[int(op.Node) % len(names)]
+			if op.Remove {
+				m.Remove(node)
+				delete(model, node)
+			} else {
+				weight := int(op.Weight % 4) + 1
+				m.AddWeighted(node, weight)
+				model[node] = weight
+			}
+			if err := checkRing(m, model); err != nil {
+				t.Log(err)
+				return false
+			}
+		}
+
+		// 按任意顺序重新添加相同的节点，得到的哈希环完全相同
+		rebuilt := New(5, hash)
+		nodes := m.Nodes()
+		for i := len(nodes) - 1; i >= 0; i-- {
+			rebuilt.AddWeighted(nodes[i], model[nodes[i]])
+		}
+		if fmt.Sprint(rebuilt.keys) != fmt.Sprint(m.keys) || !reflect.DeepEqual(rebuilt.hashMap, m.hashMap) {
+			t.Log("rebuilt ring is different")
+			return false
+		}
+		return true
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Fatal(err)
+	}
+}
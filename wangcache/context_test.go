@@ -0,0 +1,135 @@
+package wangcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetContextTimeout(t *testing.T) {
+	cancelled := make(chan struct{}, 2)
+	group := NewGroup("context-timeout", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		<-ctx.Done()
+		cancelled <- struct{}{}
+		return nil, ctx.Err()
+	}), WithTimeout(20*time.Millisecond))
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self")
+	group.RegisterPeers(pool)
+
+	if _, err := group.Get("Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect DeadlineExceeded, but got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("getter should be cancelled")
+	}
+
+	// 调用方主动取消
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := group.GetContext(ctx, "Jack"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect Canceled, but got %v", err)
+	}
+}
+
+// 共享同一次加载的请求中，一个请求被取消不会影响其他请求
+func TestGetContextShared(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loads := 0
+	group := NewGroup("context-shared", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		loads++
+		close(started)
+		select {
+		case <-release:
+			return []byte(db[key]), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}))
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self")
+	group.RegisterPeers(pool)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := group.GetContext(ctx, "Tom")
+		first <- err
+	}()
+	<-started
+
+	second := make(chan string, 1)
+	go func() {
+		view, _ := group.Get("Tom")
+		second <- view.String()
+	}()
+	// 等待第二个请求开始等待同一次加载
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect Canceled, but got %v", err)
+	}
+	close(release)
+	if val := <-second; val != db["Tom"] || loads != 1 {
+		t.Fatalf("expect %s from a single load, but got %q with %d loads", db["Tom"], val, loads)
+	}
+}
+
+func TestHTTPGetterContext(t *testing.T) {
+	timeouts := make(chan string, 1)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeouts <- r.Header.Get(timeoutHeader)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer remote.Close()
+
+	reports := 0
+	peer := &httpGetter{baseURL: remote.URL + defaultBasePath, report: func(err error) { reports++ }}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := peer.GetContext(ctx, "scores", "Tom"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect DeadlineExceeded, but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("request should be cancelled by context, but took %v", elapsed)
+	}
+	if timeout := <-timeouts; timeout == "" || timeout == "0" {
+		t.Fatalf("expect remaining timeout in %s, but got %q", timeoutHeader, timeout)
+	}
+	// 超时是调用方的原因，不能把节点判定为失败
+	if reports != 0 {
+		t.Fatalf("cancelled request should not be reported to health check")
+	}
+}
+
+func TestServeTimeout(t *testing.T) {
+	deadlines := make(chan bool, 1)
+	group := NewGroup("context-serve", 2<<10, ContextGetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		return []byte("630"), nil
+	}))
+	peer := newTestPeer(t, group)
+
+	// 远程节点以调用方剩余的超时时间作为加载的截止时间
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if data, err := peer.GetContext(ctx, "context-serve", "Tom"); err != nil || string(data) != "630" {
+		t.Fatalf("failed to get Tom, err: %v", err)
+	}
+	if !<-deadlines {
+		t.Fatalf("getter on remote peer should have a deadline")
+	}
+}
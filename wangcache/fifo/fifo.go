@@ -0,0 +1,145 @@
+package fifo
+
+import (
+	"7go/wangCache/wangcache/policy"
+	"container/list"
+	"time"
+)
+
+// Cache is a FIFO cache. It is not safe for concurrent access.
+// 使用 fifo 缓存淘汰策略：先进先出，淘汰最早添加的记录，访问记录不会改变其位置
+type Cache struct {
+	maxBytes int64                    // 缓存允许使用的最大字节数
+	nbytes   int64                    // 当前已使用的字节数
+	ll       *list.List               // 队列，新记录添加到队首，从队尾开始淘汰
+	cache    map[string]*list.Element // 键是字符串，值是队列中对应节点的指针
+	// optional and executed when an entry is purged.
+	// 某条记录被移除时的回调函数，可以为 nil
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time // 过期时间，零值表示永不过期
+}
+
+// 判断记录在 now 时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// Value use Len() to count how many bytes it takes
+type Value = policy.Value
+
+var _ policy.Cache = (*Cache)(nil)
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		ll:        list.New(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 获取缓存，与 lru 不同，访问不会改变记录在队列中的位置
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if ok {
+		kv := ele.Value.(*entry)
+		if kv.expired(time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		return kv.value, ok
+	}
+	return
+}
+
+// 移除最早添加的记录 (队尾元素)
+func (c *Cache) RemoveOldest() {
+	ele := c.ll.Back()
+	if ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+// 移除指定的缓存
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// 清空所有缓存，每条记录都会触发回调函数
+func (c *Cache) Purge() {
+	for ele := c.ll.Back(); ele != nil; ele = c.ll.Back() {
+		c.removeElement(ele)
+	}
+}
+
+// 移除所有已过期的记录，返回移除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+			n++
+		}
+		ele = prev
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// 新增/修改缓存，永不过期
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 新增/修改缓存，并设置过期时间；ttl <= 0 表示永不过期
+// 修改已存在的记录时只更新值，不改变其在队列中的位置
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.expire = expire
+	} else {
+		ele := c.ll.PushFront(&entry{key, value, expire})
+		c.cache[key] = ele
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+
+	// 超过了缓存允许使用的最大值，则开始淘汰缓存
+	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+		c.RemoveOldest()
+	}
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return c.ll.Len()
+}
+
+// 当前已使用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -0,0 +1,92 @@
+package fifo
+
+import (
+	"reflect"
+	"testing"
+)
+
+type String string
+
+// 实现Value接口
+func (d String) Len() int {
+	return len(d)
+}
+
+// 测试添加和获取缓存
+func TestGet(t *testing.T) {
+	fifo := New(int64(0), nil)
+	fifo.Add("key1", String("123"))
+
+	v, ok := fifo.Get("key1")
+	if !ok || string(v.(String)) != "123" {
+		t.Fatalf("cache hit key1=123 failed!")
+	}
+
+	if _, ok := fifo.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed!")
+	}
+}
+
+// 测试当使用内存超过了设定值时，是否会移除最早添加的记录，即使它刚被访问过
+func TestRemoveoldest(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "key3"
+	v1, v2, v3 := "value1", "value2", "value3"
+
+	cap := len(k1 + v1 + k2 + v2)
+	fifo := New(int64(cap), nil)
+	fifo.Add(k1, String(v1))
+	fifo.Add(k2, String(v2))
+	fifo.Get(k1)
+	fifo.Add(k3, String(v3))
+
+	_, ok := fifo.Get(k1)
+	if ok || fifo.Len() != 2 {
+		t.Fatalf("Removeoldest key[%s] failed!", k1)
+	}
+}
+
+// 测试回调函数能否被调用
+func TestOnEvicted(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+
+	fifo := New(int64(10), callback)
+	fifo.Add("key1", String("123456"))
+	fifo.Add("k2", String("k2"))
+	fifo.Add("k3", String("k3"))
+	fifo.Add("k4", String("k4"))
+
+	expect := []string{"key1", "k2"}
+
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, but got keys is %s", expect, keys)
+	}
+}
+
+// 测试移除指定缓存和清空缓存
+func TestRemoveAndPurge(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+
+	fifo := New(int64(0), callback)
+	fifo.Add("k1", String("v1"))
+	fifo.Add("k2", String("v2"))
+	fifo.Add("k3", String("v3"))
+
+	fifo.Remove("k2")
+	if _, ok := fifo.Get("k2"); ok || fifo.Len() != 2 {
+		t.Fatalf("Remove key[k2] failed!")
+	}
+
+	fifo.Purge()
+	if _, ok := fifo.Get("k1"); ok || fifo.Len() != 0 {
+		t.Fatalf("Purge failed!")
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expect OnEvicted to be called 3 times, but got %d", len(keys))
+	}
+}
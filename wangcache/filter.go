@@ -0,0 +1,65 @@
+package wangcache
+
+import (
+	"7go/wangCache/wangcache/bloom"
+	"errors"
+	"sync"
+)
+
+// 布隆过滤器守卫：在回源加载之前拦截一定不存在的key，防止随机key扫描打穿数据源
+
+var errNoBloomFilter = errors.New("wangcache: bloom filter is not enabled")
+
+// keyFilter 为 bloom.Filter 加上读写锁，使其可以被并发访问
+type keyFilter struct {
+	mu     sync.RWMutex
+	filter *bloom.Filter
+}
+
+func (f *keyFilter) add(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.filter.Add(key)
+}
+
+func (f *keyFilter) mayContain(key string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.filter.Test(key)
+}
+
+// SeedBloomFilter 通过迭代器将数据源中所有的key批量添加到布隆过滤器中，返回添加的key的个数
+// 布隆过滤器会拦截所有未添加过的key，所以开启后必须先用数据源中全部的key进行预热
+func (g *Group) SeedBloomFilter(next func() (key string, ok bool)) (int, error) {
+	if g.filter == nil {
+		return 0, errNoBloomFilter
+	}
+	g.filter.mu.Lock()
+	defer g.filter.mu.Unlock()
+	return g.filter.filter.Seed(next), nil
+}
+
+// BloomFilter 返回序列化后的布隆过滤器，用于发送给其他节点
+func (g *Group) BloomFilter() ([]byte, error) {
+	if g.filter == nil {
+		return nil, errNoBloomFilter
+	}
+	g.filter.mu.RLock()
+	defer g.filter.mu.RUnlock()
+	return g.filter.filter.MarshalBinary()
+}
+
+// MergeBloomFilter 将其他节点序列化后的布隆过滤器合并到当前Group的布隆过滤器中
+// 每个节点只会把自己回源加载成功的key添加到布隆过滤器，合并后才能感知到其他节点新增的key
+func (g *Group) MergeBloomFilter(data []byte) error {
+	if g.filter == nil {
+		return errNoBloomFilter
+	}
+	other := new(bloom.Filter)
+	if err := other.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	g.filter.mu.Lock()
+	defer g.filter.mu.Unlock()
+	return g.filter.filter.Merge(other)
+}
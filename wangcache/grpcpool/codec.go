@@ -0,0 +1,41 @@
+package grpcpool
+
+import (
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"fmt"
+)
+
+// codec 使用 wangcachepb 消息的 Marshal/Unmarshal 实现 gRPC 的 encoding.Codec 接口，
+// 这样使用 -tags wangcachepb_nogen 构建 (手写的编解码) 时同样可以工作
+// 编码结果与标准 protobuf 一致，所以名字仍然是 "proto"，其他语言生成的 gRPC 客户端也可以直接访问
+type codec struct{}
+
+type message interface {
+	Marshal() ([]byte, error)
+	Unmarshal(data []byte) error
+}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("grpcpool: cannot marshal %T", v)
+	}
+	return m.Marshal()
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("grpcpool: cannot unmarshal into %T", v)
+	}
+	return m.Unmarshal(data)
+}
+
+func (codec) Name() string {
+	return "proto"
+}
+
+var (
+	_ message = (*pb.Request)(nil)
+	_ message = (*pb.Response)(nil)
+)
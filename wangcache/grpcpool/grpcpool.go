@@ -0,0 +1,409 @@
+package grpcpool
+
+import (
+	"7go/wangCache/wangcache"
+	"7go/wangCache/wangcache/consistenthash"
+	"7go/wangCache/wangcache/logger"
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+//提供被其他节点访问的能力(基于gRPC)，可以替代 HTTPPool
+
+//与 HTTPPool 一样使用一致性哈希选择节点，支持写操作 (Set/Remove)、多副本、失效广播，
+//也可以通过 AddPeers/RemovePeers 修改集群成员 (实现了 membership.Ring)，区别在于：
+//  - 每个节点只建立一个 gRPC 连接 (HTTP/2 多路复用)，所有请求复用这个连接
+//  - 支持通过双向流批量获取多个key，一次往返即可拿到所有结果
+//  - 没有内置的健康检查 (HTTPPool 的 WithHealthCheck)，也不支持按权重或负载放置，需要时由外部调用 AddPeers/RemovePeers
+
+const defaultReplicas = 50
+
+type GRPCPool struct {
+	self    string // 用来记录自己的地址，格式是 host:port
+	mu      sync.Mutex
+	peers   *consistenthash.Map    // 一致性哈希算法的Map，用来根据具体的 key选择节点
+	getters map[string]*grpcGetter // 映射远程节点与对应的grpcGetter
+	opts    []grpc.DialOption      // 建立连接时使用的参数
+
+	registry *wangcache.Registry // 处理请求时从这里查找group，默认是 wangcache.DefaultRegistry
+	logger   logger.Logger       // 默认不输出日志
+}
+
+// 新建 GRPCPool，opts 为连接其他节点时使用的参数，默认不使用 TLS
+func NewGRPCPool(self string, opts ...grpc.DialOption) *GRPCPool {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return &GRPCPool{
+		self:    self,
+		getters: make(map[string]*grpcGetter),
+		opts:    opts,
+
+		registry: wangcache.DefaultRegistry,
+		logger:   logger.Nop,
+	}
+}
+
+// 设置处理请求时查找group的 Registry，需要在 Register 之前调用
+func (p *GRPCPool) SetRegistry(r *wangcache.Registry) {
+	p.registry = r
+}
+
+// 设置输出日志的 Logger，需要在 Set 之前调用
+// 实现logger.Setter接口
+func (p *GRPCPool) SetLogger(l logger.Logger) {
+	p.logger = l
+}
+
+// 设置集群中的所有节点，已经存在的节点会继续使用原来的连接，被移除的节点会关闭连接
+func (p *GRPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.peers = p.newRing()
+	p.peers.Add(peers...)
+
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if getter, ok := p.getters[peer]; ok {
+			getters[peer] = getter
+			delete(p.getters, peer)
+			continue
+		}
+		getters[peer] = &grpcGetter{addr: peer, opts: p.opts}
+	}
+	for _, getter := range p.getters {
+		getter.close()
+	}
+	p.getters = getters
+}
+
+// 新建一致性哈希的Map，调用时需要持有 p.mu
+func (p *GRPCPool) newRing() *consistenthash.Map {
+	peers := consistenthash.New(defaultReplicas, nil)
+	peers.SetLogger(p.logger)
+	return peers
+}
+
+// 向哈希环中添加节点，已经存在的节点会被忽略
+// 实现membership.Ring接口
+func (p *GRPCPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		p.peers = p.newRing()
+	}
+	for _, peer := range peers {
+		if _, ok := p.getters[peer]; ok {
+			continue
+		}
+		p.peers.Add(peer)
+		p.getters[peer] = &grpcGetter{addr: peer, opts: p.opts}
+	}
+}
+
+// 从哈希环中移除节点并关闭连接，不存在的节点会被忽略
+// 实现membership.Ring接口
+func (p *GRPCPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, peer := range peers {
+		getter, ok := p.getters[peer]
+		if !ok {
+			continue
+		}
+		p.peers.Remove(peer)
+		getter.close()
+		delete(p.getters, peer)
+	}
+}
+
+// 返回集群中的所有节点 (包括自己)，按地址排序
+func (p *GRPCPool) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peers := make([]string, 0, len(p.getters))
+	for peer := range p.getters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// 返回当前节点的地址
+// 实现SelfIdentifier接口
+func (p *GRPCPool) Self() string {
+	return p.self
+}
+
+// 根据具体的 key，选择节点，返回节点对应的 gRPC 客户端
+// 实现PeerPicker接口
+func (p *GRPCPool) PickPeer(key string) (wangcache.PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		p.logger.Debug("pick peer", "key", key, "peer", peer)
+		return p.getters[peer], true
+	}
+	return nil, false
+}
+
+// 根据具体的 key，选择负责该key的 n 个节点，返回其中远程节点对应的 gRPC 客户端
+// 实现ReplicaPicker接口
+func (p *GRPCPool) PickReplicas(key string, n int) ([]wangcache.PeerGetter, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		return nil, -1
+	}
+	self := -1
+	nodes := p.peers.GetN(key, n)
+	peers := make([]wangcache.PeerGetter, 0, len(nodes))
+	for i, node := range nodes {
+		if node == p.self {
+			self = i
+			continue
+		}
+		peers = append(peers, p.getters[node])
+	}
+	return peers, self
+}
+
+// 返回除自己以外的所有节点对应的 gRPC 客户端
+// 实现PeerLister接口
+func (p *GRPCPool) ListPeers() []wangcache.PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peers := make([]wangcache.PeerGetter, 0, len(p.getters))
+	for peer, getter := range p.getters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+var (
+	_ wangcache.PeerPicker     = (*GRPCPool)(nil)
+	_ wangcache.ReplicaPicker  = (*GRPCPool)(nil)
+	_ wangcache.PeerLister     = (*GRPCPool)(nil)
+	_ wangcache.SelfIdentifier = (*GRPCPool)(nil)
+)
+
+// 将 wangCache 的服务注册到 gRPC 服务器上
+// 服务器需要使用与 wangcachepb 相同的编解码：grpc.NewServer(grpcpool.ServerOption())
+func (p *GRPCPool) Register(s *grpc.Server) {
+	s.RegisterService(&serviceDesc, server{registry: p.registry})
+}
+
+// 创建 gRPC 服务器时需要传入的参数，使用 wangcachepb 的编解码
+func ServerOption() grpc.ServerOption {
+	return grpc.ForceServerCodec(codec{})
+}
+
+// 关闭所有节点的连接
+func (p *GRPCPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, getter := range p.getters {
+		getter.close()
+	}
+	return nil
+}
+
+//**********************************
+// 实现gRPC客户端
+//**********************************
+
+type grpcGetter struct {
+	addr string
+	opts []grpc.DialOption
+	mu   sync.Mutex
+	conn *grpc.ClientConn // 第一次请求时才建立连接，之后一直复用
+}
+
+var (
+	_ wangcache.PeerGetter      = (*grpcGetter)(nil)
+	_ wangcache.PeerFetcher     = (*grpcGetter)(nil)
+	_ wangcache.PeerTTLSetter   = (*grpcGetter)(nil)
+	_ wangcache.PeerRemover     = (*grpcGetter)(nil)
+	_ wangcache.PeerInvalidator = (*grpcGetter)(nil)
+)
+
+// 节点的地址，用于日志
+func (g *grpcGetter) String() string {
+	return g.addr
+}
+
+func (g *grpcGetter) connect() (*grpc.ClientConn, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.conn == nil {
+		// passthrough 直接把地址交给拨号函数，不经过 DNS 解析器
+		conn, err := grpc.NewClient("passthrough:///"+g.addr, g.opts...)
+		if err != nil {
+			return nil, err
+		}
+		g.conn = conn
+	}
+	return g.conn, nil
+}
+
+func (g *grpcGetter) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.conn != nil {
+		g.conn.Close()
+		g.conn = nil
+	}
+}
+
+// 实现PeerGetter接口
+func (g *grpcGetter) Get(group string, key string) ([]byte, error) {
+	return g.GetContext(context.Background(), group, key)
+}
+
+// 实现ContextPeerGetter接口
+func (g *grpcGetter) GetContext(ctx context.Context, group string, key string) ([]byte, error) {
+	out := new(pb.Response)
+	if err := g.FetchContext(ctx, &pb.Request{Version: pb.Version, Group: group, Key: key}, out); err != nil {
+		return nil, err
+	}
+	return out.Value, nil
+}
+
+// 实现PeerFetcher接口
+func (g *grpcGetter) Fetch(in *pb.Request, out *pb.Response) error {
+	return g.FetchContext(context.Background(), in, out)
+}
+
+// 实现ContextPeerFetcher接口，ctx 的截止时间由 gRPC 传递给服务端
+func (g *grpcGetter) FetchContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.invoke(ctx, getMethod, in, out)
+}
+
+// 设置远程节点上的缓存值
+// 实现PeerSetter接口
+func (g *grpcGetter) Set(group string, key string, value []byte) error {
+	return g.SetWithTTL(group, key, value, 0)
+}
+
+// 设置远程节点上的缓存值，经过 ttl 后过期，不足1毫秒按1毫秒计算
+// 实现PeerTTLSetter接口
+func (g *grpcGetter) SetWithTTL(group string, key string, value []byte, ttl time.Duration) error {
+	var ms int64
+	if ttl > 0 {
+		ms = int64((ttl + time.Millisecond - 1) / time.Millisecond)
+	}
+	in := &pb.Request{Version: pb.Version, Group: group, Key: key, Value: value, Ttl: ms}
+	return g.invoke(context.Background(), setMethod, in, new(pb.Response))
+}
+
+// 删除远程节点上的缓存值
+// 实现PeerRemover接口
+func (g *grpcGetter) Remove(group string, key string) error {
+	in := &pb.Request{Version: pb.Version, Group: group, Key: key}
+	return g.invoke(context.Background(), removeMethod, in, new(pb.Response))
+}
+
+// 通知远程节点丢弃 hotCache 中的副本
+// 实现PeerInvalidator接口
+func (g *grpcGetter) Invalidate(group string, key string) error {
+	in := &pb.Request{Version: pb.Version, Group: group, Key: key}
+	return g.invoke(context.Background(), invalidateMethod, in, new(pb.Response))
+}
+
+// 调用一元方法，这些请求都是节点之间转发的，所以都带上 forwardedKey
+func (g *grpcGetter) invoke(ctx context.Context, method string, in *pb.Request, out *pb.Response) error {
+	conn, err := g.connect()
+	if err != nil {
+		return err
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, forwardedKey, "1")
+	if err := conn.Invoke(ctx, method, in, out, grpc.ForceCodec(codec{})); err != nil {
+		return err
+	}
+	return responseError(out)
+}
+
+// 通过双向流批量获取多个key，返回的结果与 keys 一一对应
+// 单个key的错误记录在对应 Response 的 ErrorKind 中，只有连接出错时才返回 error
+func (g *grpcGetter) GetBatch(group string, keys []string) ([]*pb.Response, error) {
+	return g.GetBatchContext(context.Background(), group, keys)
+}
+
+// 实现ContextPeerBatchGetter接口
+func (g *grpcGetter) GetBatchContext(ctx context.Context, group string, keys []string) ([]*pb.Response, error) {
+	conn, err := g.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(ctx, forwardedKey, "1"))
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], getBatchMethod, grpc.ForceCodec(codec{}))
+	if err != nil {
+		return nil, err
+	}
+
+	// 发送与接收并行进行，避免key很多时双方的缓冲区被填满而互相等待
+	sendErr := make(chan error, 1)
+	go func() {
+		for _, key := range keys {
+			if err := stream.SendMsg(&pb.Request{Version: pb.Version, Group: group, Key: key}); err != nil {
+				sendErr <- err
+				return
+			}
+		}
+		sendErr <- stream.CloseSend()
+	}()
+
+	results := make([]*pb.Response, 0, len(keys))
+	for range keys {
+		out := new(pb.Response)
+		if err := stream.RecvMsg(out); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		results = append(results, out)
+	}
+	if err := <-sendErr; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// 将 Response 中的错误转换为 error
+func responseError(out *pb.Response) error {
+	switch out.ErrorKind {
+	case pb.ErrorKind_NONE:
+		return nil
+	case pb.ErrorKind_NOT_FOUND:
+		return wangcache.ErrNotFound
+	default:
+		return fmt.Errorf("server returned: %v, %s", out.ErrorKind, out.Error)
+	}
+}
@@ -0,0 +1,314 @@
+package grpcpool
+
+import (
+	"7go/wangCache/wangcache"
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var db = map[string]string{
+	"Tom":  "630",
+	"Jack": "589",
+	"Sam":  "567",
+}
+
+// 在内存中启动一个gRPC节点，返回连接该节点使用的参数
+func newTestServer(t *testing.T) []grpc.DialOption {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(ServerOption())
+	NewGRPCPool("self").Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	return []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+}
+
+func newTestGroup(name string, loads *int32) *wangcache.Group {
+	group := wangcache.NewGroup(name, 2<<10, wangcache.GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(loads, 1)
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("key [%s]: %w", key, wangcache.ErrNotFound)
+	}))
+	// 服务端只有自己一个节点，所有的key都在本地加载
+	pool := wangcache.NewHTTPPool("http://self")
+	pool.Set("http://self")
+	group.RegisterPeers(pool)
+	return group
+}
+
+// 返回一个会被分配给远程节点的key
+func remoteKey(t *testing.T, pool *GRPCPool) (wangcache.PeerGetter, string) {
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		if peer, ok := pool.PickPeer(key); ok {
+			return peer, key
+		}
+	}
+	t.Fatal("no key is assigned to the remote peer")
+	return nil, ""
+}
+
+func TestGRPCGetter(t *testing.T) {
+	var loads int32
+	newTestGroup("grpc-scores", &loads)
+
+	pool := NewGRPCPool("self", newTestServer(t)...)
+	defer pool.Close()
+	pool.Set("self", "remote")
+	peer, _ := remoteKey(t, pool)
+
+	for i := 0; i < 2; i++ {
+		data, err := peer.Get("grpc-scores", "Tom")
+		if err != nil || string(data) != db["Tom"] {
+			t.Fatalf("failed to get Tom from peer, err: %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect Tom to be loaded once by the peer, but got %d", loads)
+	}
+
+	if _, err := peer.Get("grpc-scores", "unknown"); !errors.Is(err, wangcache.ErrNotFound) {
+		t.Fatalf("expect ErrNotFound for unknown key, but got %v", err)
+	}
+	if _, err := peer.Get("no-such-group", "Tom"); err == nil || errors.Is(err, wangcache.ErrNotFound) {
+		t.Fatalf("expect a non ErrNotFound error for unknown group, but got %v", err)
+	}
+
+	// 带过期时间的值需要把剩余的 TTL 一起返回
+	out := new(pb.Response)
+	if err := peer.(wangcache.PeerFetcher).Fetch(&pb.Request{Group: "grpc-scores", Key: "Jack"}, out); err != nil || string(out.Value) != db["Jack"] {
+		t.Fatalf("failed to fetch Jack from peer, err: %v", err)
+	}
+}
+
+func TestGetBatch(t *testing.T) {
+	var loads int32
+	newTestGroup("grpc-batch", &loads)
+
+	pool := NewGRPCPool("self", newTestServer(t)...)
+	defer pool.Close()
+	pool.Set("self", "remote")
+	peer, _ := remoteKey(t, pool)
+
+	keys := []string{"Tom", "unknown", "Jack", "Sam", "Tom"}
+	results, err := peer.(*grpcGetter).GetBatch("grpc-batch", keys)
+	if err != nil {
+		t.Fatalf("failed to get batch, err: %v", err)
+	}
+	if len(results) != len(keys) {
+		t.Fatalf("expect %d results, but got %d", len(keys), len(results))
+	}
+	for i, key := range keys {
+		res := results[i]
+		if res.Key != key {
+			t.Fatalf("result %d: expect key %s, but got %s", i, key, res.Key)
+		}
+		if v, ok := db[key]; ok {
+			if res.ErrorKind != pb.ErrorKind_NONE || string(res.Value) != v {
+				t.Fatalf("result %d: expect %s=%s, but got %q (%v)", i, key, v, res.Value, res.ErrorKind)
+			}
+		} else if res.ErrorKind != pb.ErrorKind_NOT_FOUND {
+			t.Fatalf("result %d: expect NOT_FOUND for %s, but got %v", i, key, res.ErrorKind)
+		}
+	}
+}
+
+// 同一个流中的key通过 GetMultiContext 批量获取，未命中的key合并成一次 GetMulti 调用
+func TestGetBatchMulti(t *testing.T) {
+	var calls int32
+	group := wangcache.NewGroup("grpc-batch-multi", 2<<10, wangcache.BatchGetterFunc(func(keys []string) (map[string][]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		values := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			values[key] = []byte("v-" + key)
+		}
+		return values, nil
+	}), wangcache.WithBatchWindow(time.Second, 8))
+	pool := wangcache.NewHTTPPool("http://self")
+	pool.Set("http://self")
+	group.RegisterPeers(pool)
+
+	grpcPool := NewGRPCPool("self", newTestServer(t)...)
+	defer grpcPool.Close()
+	grpcPool.Set("self", "remote")
+	peer, _ := remoteKey(t, grpcPool)
+
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+	results, err := peer.(*grpcGetter).GetBatch("grpc-batch-multi", keys)
+	if err != nil {
+		t.Fatalf("failed to get batch, err: %v", err)
+	}
+	for i, key := range keys {
+		if string(results[i].Value) != "v-"+key {
+			t.Fatalf("result %d: expect v-%s, but got %q", i, key, results[i].Value)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expect 1 GetMulti call, but got %d", calls)
+	}
+}
+
+func TestConnReuse(t *testing.T) {
+	var loads int32
+	newTestGroup("grpc-reuse", &loads)
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(ServerOption())
+	NewGRPCPool("remote").Register(s)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	var dials int32
+	pool := NewGRPCPool("self",
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			atomic.AddInt32(&dials, 1)
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	defer pool.Close()
+	pool.Set("self", "remote")
+	peer := pool.getters["remote"]
+
+	for i := 0; i < 10; i++ {
+		if _, err := peer.Get("grpc-reuse", "Tom"); err != nil {
+			t.Fatalf("failed to get Tom from peer, err: %v", err)
+		}
+	}
+
+	// 重新设置节点时，已经存在的节点继续使用原来的连接
+	pool.Set("self", "remote", "other")
+	if pool.getters["remote"] != peer {
+		t.Fatalf("expect the getter of remote to be reused after Set")
+	}
+	if _, err := peer.Get("grpc-reuse", "Sam"); err != nil {
+		t.Fatalf("failed to get Sam from peer, err: %v", err)
+	}
+	if dials != 1 {
+		t.Fatalf("expect a single connection to the peer, but dialed %d times", dials)
+	}
+
+	// 被移除的节点需要关闭连接
+	pool.Set("self", "other")
+	if peer.conn != nil {
+		t.Fatalf("expect the connection to the removed peer to be closed")
+	}
+}
+
+// 在内存中启动多个gRPC节点，peers 为每个节点的节点列表，每个节点使用独立的 Registry
+// 返回每个节点上的group、GRPCPool，以及从数据源加载的次数
+func newTestCluster(t *testing.T, peers map[string][]string, opts ...wangcache.GroupOption) (map[string]*wangcache.Group, map[string]*GRPCPool, map[string]*int32) {
+	listeners := make(map[string]*bufconn.Listener)
+	for self := range peers {
+		listeners[self] = bufconn.Listen(1 << 20)
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return listeners[addr].DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+
+	groups := make(map[string]*wangcache.Group)
+	pools := make(map[string]*GRPCPool)
+	loads := make(map[string]*int32)
+	for self, list := range peers {
+		n := new(int32)
+		loads[self] = n
+		registry := wangcache.NewRegistry()
+		group, err := registry.NewGroup("grpc-cluster", 2<<10, wangcache.GetterFunc(func(key string) ([]byte, error) {
+			atomic.AddInt32(n, 1)
+			return []byte("v-" + key), nil
+		}), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool := NewGRPCPool(self, dialOpts...)
+		pool.SetRegistry(registry)
+		pool.Set(list...)
+		t.Cleanup(func() { pool.Close() })
+		group.RegisterPeers(pool)
+		groups[self] = group
+		pools[self] = pool
+
+		s := grpc.NewServer(ServerOption())
+		pool.Register(s)
+		go s.Serve(listeners[self])
+		t.Cleanup(s.Stop)
+	}
+	return groups, pools, loads
+}
+
+// 两个节点的节点列表不一致：a 认为所有key都由 b 负责，b 认为所有key都由 a 负责
+// 转发过来的请求必须在本地加载，而不是再转发回去
+func TestForwardedGet(t *testing.T) {
+	groups, _, loads := newTestCluster(t, map[string][]string{"a": {"b"}, "b": {"a"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if view, err := groups["a"].GetContext(ctx, "Tom"); err != nil || view.String() != "v-Tom" {
+		t.Fatalf("expect v-Tom, but got %q, err: %v", view, err)
+	}
+	results := groups["a"].GetMultiContext(ctx, []string{"Jack", "Sam"})
+	for i, key := range []string{"Jack", "Sam"} {
+		if results[i].Err != nil || results[i].Value.String() != "v-"+key {
+			t.Fatalf("expect v-%s, but got %+v", key, results[i])
+		}
+	}
+	if *loads["a"] != 0 || *loads["b"] != 3 {
+		t.Fatalf("expect all keys to be loaded by b, but got a=%d, b=%d", *loads["a"], *loads["b"])
+	}
+}
+
+// 写操作通过 gRPC 路由到负责该key的节点
+func TestWrites(t *testing.T) {
+	groups, pools, loads := newTestCluster(t, map[string][]string{"a": {"a", "b"}, "b": {"a", "b"}},
+		wangcache.WithTTL(time.Minute, 0), wangcache.WithBroadcastInvalidation())
+	peer, key := remoteKey(t, pools["a"])
+
+	if err := groups["a"].SetWithTTL(key, []byte("x"), time.Second); err != nil {
+		t.Fatalf("failed to set %s, err: %v", key, err)
+	}
+	out := new(pb.Response)
+	if err := peer.(wangcache.PeerFetcher).Fetch(&pb.Request{Group: "grpc-cluster", Key: key}, out); err != nil || string(out.Value) != "x" || out.Ttl <= 0 || out.Ttl > 1001 {
+		t.Fatalf("expect %s=x with ttl <= 1s on b, but got %+v, err: %v", key, out, err)
+	}
+
+	if err := groups["a"].Remove(key); err != nil {
+		t.Fatalf("failed to remove %s, err: %v", key, err)
+	}
+	if view, err := groups["b"].Get(key); err != nil || view.String() != "v-"+key || *loads["b"] != 1 {
+		t.Fatalf("expect %s to be reloaded by b, but got %q, loads: %d, err: %v", key, view, *loads["b"], err)
+	}
+
+	// 移除节点后，该节点负责的key由当前节点负责
+	pools["a"].RemovePeers("b")
+	if _, ok := pools["a"].PickPeer(key); ok || !reflect.DeepEqual(pools["a"].Peers(), []string{"a"}) {
+		t.Fatalf("expect b to be removed, but got %v", pools["a"].Peers())
+	}
+	pools["a"].AddPeers("b")
+	if got, ok := pools["a"].PickPeer(key); !ok || got.(*grpcGetter).addr != "b" {
+		t.Fatalf("expect %s to be assigned to b again, but got %v", key, got)
+	}
+}
@@ -0,0 +1,219 @@
+package grpcpool
+
+import (
+	"7go/wangCache/wangcache"
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+//gRPC 服务端：手写的服务描述，等价于 protoc-gen-go-grpc 根据 wangcachepb.proto 生成的代码
+
+const (
+	serviceName      = "wangcachepb.WangCache"
+	getMethod        = "/" + serviceName + "/Get"
+	getBatchMethod   = "/" + serviceName + "/GetBatch"
+	setMethod        = "/" + serviceName + "/Set"
+	removeMethod     = "/" + serviceName + "/Remove"
+	invalidateMethod = "/" + serviceName + "/Invalidate"
+)
+
+// 节点之间转发的请求会在 metadata 中带上该字段，服务端直接在本地加载，不再路由
+// (与 HTTPPool 的 X-Wangcache-Forwarded 请求头相同)，避免各节点的哈希环不一致时请求被来回转发
+const forwardedKey = "x-wangcache-forwarded"
+
+// 请求是否由其他节点转发而来
+func forwarded(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(forwardedKey)) > 0
+}
+
+type wangCacheServer interface {
+	Get(ctx context.Context, in *pb.Request) (*pb.Response, error)
+	GetBatch(stream grpc.ServerStream) error
+	Set(ctx context.Context, in *pb.Request) (*pb.Response, error)
+	Remove(ctx context.Context, in *pb.Request) (*pb.Response, error)
+	Invalidate(ctx context.Context, in *pb.Request) (*pb.Response, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*wangCacheServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Get", Handler: unaryHandler(getMethod, wangCacheServer.Get)},
+		{MethodName: "Set", Handler: unaryHandler(setMethod, wangCacheServer.Set)},
+		{MethodName: "Remove", Handler: unaryHandler(removeMethod, wangCacheServer.Remove)},
+		{MethodName: "Invalidate", Handler: unaryHandler(invalidateMethod, wangCacheServer.Invalidate)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "GetBatch", Handler: getBatchHandler, ServerStreams: true, ClientStreams: true},
+	},
+	Metadata: "wangcachepb.proto",
+}
+
+// 所有一元方法的请求和响应都是 Request/Response，只是调用的方法不同
+func unaryHandler(method string, call func(wangCacheServer, context.Context, *pb.Request) (*pb.Response, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(pb.Request)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(wangCacheServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: method}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return call(srv.(wangCacheServer), ctx, req.(*pb.Request))
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+func getBatchHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(wangCacheServer).GetBatch(stream)
+}
+
+// server 从 GRPCPool 的 Registry 中查找group并获取缓存值
+type server struct {
+	registry *wangcache.Registry
+}
+
+// 错误通过 Response.ErrorKind 返回，与 HTTPPool 的 protobuf 响应保持一致
+// 其他节点转发过来的请求直接在本地加载，客户端直接发送的请求按照一致性哈希路由
+func (s server) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	group := s.registry.GetGroup(in.Group)
+	if group == nil {
+		return noSuchGroup(in), nil
+	}
+	var view wangcache.ByteView
+	var err error
+	if forwarded(ctx) {
+		view, err = group.GetLocalContext(ctx, in.Key)
+	} else {
+		view, err = group.GetContext(ctx, in.Key)
+	}
+	return response(in, view, err), nil
+}
+
+// 先读取流中的所有请求，按group分组后通过 GetMultiContext 批量获取 (与 HTTPPool 的 _batch 接口相同)，
+// 再按请求的顺序依次返回响应，这样未命中的key才能合并成批量请求或合并回源 (BatchGetter)
+func (s server) GetBatch(stream grpc.ServerStream) error {
+	var requests []*pb.Request
+	for {
+		in := new(pb.Request)
+		if err := stream.RecvMsg(in); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		requests = append(requests, in)
+	}
+
+	// 每个group中的请求在 requests 中的下标
+	groups := make(map[string][]int)
+	for i, in := range requests {
+		groups[in.Group] = append(groups[in.Group], i)
+	}
+
+	getMulti := (*wangcache.Group).GetMultiContext
+	if forwarded(stream.Context()) {
+		getMulti = (*wangcache.Group).GetMultiLocalContext
+	}
+	responses := make([]*pb.Response, len(requests))
+	for name, idx := range groups {
+		group := s.registry.GetGroup(name)
+		if group == nil {
+			for _, i := range idx {
+				responses[i] = noSuchGroup(requests[i])
+			}
+			continue
+		}
+		keys := make([]string, len(idx))
+		for j, i := range idx {
+			keys[j] = requests[i].Key
+		}
+		for j, result := range getMulti(group, stream.Context(), keys) {
+			responses[idx[j]] = response(requests[idx[j]], result.Value, result.Err)
+		}
+	}
+
+	for _, res := range responses {
+		if err := stream.SendMsg(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 设置缓存值，其他节点转发过来的请求直接在本地设置，否则路由到负责该key的节点 (与 HTTPPool 的 PUT 请求相同)
+func (s server) Set(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	group := s.registry.GetGroup(in.Group)
+	if group == nil {
+		return noSuchGroup(in), nil
+	}
+	ttl := time.Duration(in.Ttl) * time.Millisecond
+	if forwarded(ctx) {
+		group.SetLocal(in.Key, in.Value, ttl)
+		return response(in, wangcache.ByteView{}, nil), nil
+	}
+	return response(in, wangcache.ByteView{}, group.SetWithTTL(in.Key, in.Value, ttl)), nil
+}
+
+// 删除缓存值，其他节点转发过来的请求直接在本地删除，否则路由到负责该key的节点
+func (s server) Remove(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	group := s.registry.GetGroup(in.Group)
+	if group == nil {
+		return noSuchGroup(in), nil
+	}
+	if forwarded(ctx) {
+		group.RemoveLocal(in.Key)
+		return response(in, wangcache.ByteView{}, nil), nil
+	}
+	return response(in, wangcache.ByteView{}, group.Remove(in.Key)), nil
+}
+
+// 丢弃 hotCache 中的副本 (用于失效广播)
+func (s server) Invalidate(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	group := s.registry.GetGroup(in.Group)
+	if group == nil {
+		return noSuchGroup(in), nil
+	}
+	group.Invalidate(in.Key)
+	return response(in, wangcache.ByteView{}, nil), nil
+}
+
+func noSuchGroup(in *pb.Request) *pb.Response {
+	return &pb.Response{
+		Version:   pb.Version,
+		Group:     in.Group,
+		Key:       in.Key,
+		ErrorKind: pb.ErrorKind_NO_SUCH_GROUP,
+		Error:     "no such group: " + in.Group,
+	}
+}
+
+// 根据获取的结果构造响应
+func response(in *pb.Request, view wangcache.ByteView, err error) *pb.Response {
+	res := &pb.Response{Version: pb.Version, Group: in.Group, Key: in.Key}
+	if err != nil {
+		res.ErrorKind = pb.ErrorKind_INTERNAL
+		if errors.Is(err, wangcache.ErrNotFound) {
+			res.ErrorKind = pb.ErrorKind_NOT_FOUND
+		}
+		res.Error = err.Error()
+		return res
+	}
+
+	res.Value = view.ByteSlice()
+	if e := view.Expire(); !e.IsZero() {
+		// 剩余的过期时间，至少为1毫秒，避免被当作永不过期
+		res.Ttl = time.Until(e).Milliseconds() + 1
+	}
+	return res
+}
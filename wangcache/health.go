@@ -0,0 +1,206 @@
+package wangcache
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//节点健康检查
+
+//PickPeer 只根据一致性哈希选择节点，节点宕机后请求仍然会被发往该节点。
+//开启健康检查后，HTTPPool 会记录每个远程节点连续失败/成功的次数：
+//  - 主动检查：后台定期请求每个节点的 /<basepath>/_health 接口
+//  - 被动检查：httpGetter 访问节点时发生的网络错误
+//连续失败 fall 次的节点会被移出哈希环，它负责的key由环上的下一个节点接管；
+//之后主动检查连续成功 rise 次才会重新加入哈希环。
+//失败与恢复使用不同的阈值 (滞后)，避免网络抖动时节点被频繁地移出、加入，导致key来回迁移
+
+// 健康检查接口，节点正常时返回200: /<basepath>/_health
+const healthPath = "_health"
+
+const (
+	defaultHealthInterval = 5 * time.Second
+	defaultHealthFall     = 3
+	defaultHealthRise     = 2
+)
+
+type healthConfig struct {
+	interval time.Duration // 主动检查的时间间隔
+	fall     int           // 连续失败多少次后移出哈希环
+	rise     int           // 连续成功多少次后重新加入哈希环
+	client   *http.Client  // 主动检查使用的客户端，超时时间为 timeout
+}
+
+// 远程节点的健康状态
+type peerState struct {
+	healthy   bool // 是否在哈希环上
+	failures  int  // 连续失败的次数
+	successes int  // 连续成功的次数
+}
+
+// WithHealthCheck 开启节点健康检查
+// interval 为主动检查的间隔，timeout 为每次检查的超时时间 (默认等于 interval)，
+// 连续失败 fall 次 (默认3次) 的节点会被移出哈希环，连续成功 rise 次 (默认2次) 后重新加入
+func WithHealthCheck(interval, timeout time.Duration, fall, rise int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		if interval <= 0 {
+			interval = defaultHealthInterval
+		}
+		if timeout <= 0 {
+			timeout = interval
+		}
+		if fall <= 0 {
+			fall = defaultHealthFall
+		}
+		if rise <= 0 {
+			rise = defaultHealthRise
+		}
+		p.health = &healthConfig{
+			interval: interval,
+			fall:     fall,
+			rise:     rise,
+			client:   &http.Client{Timeout: timeout},
+		}
+	}
+}
+
+// 节点加入集群，健康的节点才会被加入哈希环，调用时需要持有 p.mu
+// 新节点默认是健康的，已经存在的节点保留原来的状态
+func (p *HTTPPool) admit(peer string) {
+	if p.health == nil || peer == p.self {
+		p.place(peer)
+		return
+	}
+
+	st, ok := p.states[peer]
+	if !ok {
+		st = &peerState{healthy: true}
+		p.states[peer] = st
+	}
+	if st.healthy {
+		p.place(peer)
+	}
+}
+
+// 节点离开集群，调用时需要持有 p.mu
+func (p *HTTPPool) forget(peer string) {
+	// 已经被移出哈希环的节点不需要再次移除
+	if st, ok := p.states[peer]; !ok || st.healthy {
+		p.peers.Remove(peer)
+	}
+	delete(p.states, peer)
+}
+
+// 记录一次对远程节点的访问结果，err 为 nil 表示节点可以访问
+func (p *HTTPPool) report(peer string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	st, ok := p.states[peer]
+	if !ok {
+		// 节点已经离开集群
+		return
+	}
+
+	if err != nil {
+		st.successes = 0
+		st.failures++
+		if st.healthy && st.failures >= p.health.fall {
+			st.healthy = false
+			p.peers.Remove(peer)
+			p.logger.Warn("peer ejected from ring", "self", p.self, "peer", peer, "failures", st.failures, "error", err)
+		}
+		return
+	}
+
+	st.failures = 0
+	st.successes++
+	if !st.healthy && st.successes >= p.health.rise {
+		st.healthy = true
+		p.place(peer)
+		p.logger.Info("peer re-admitted to ring", "self", p.self, "peer", peer, "successes", st.successes)
+	}
+}
+
+// 后台定期检查所有远程节点，直到 Close 被调用
+func (p *HTTPPool) checkHealth() {
+	ticker := time.NewTicker(p.health.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.probeAll()
+		}
+	}
+}
+
+// 并发检查所有远程节点 (包括已经被移出哈希环的节点)
+func (p *HTTPPool) probeAll() {
+	p.mu.Lock()
+	peers := make([]string, 0, len(p.states))
+	for peer := range p.states {
+		peers = append(peers, peer)
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			p.report(peer, p.probe(peer))
+		}(peer)
+	}
+	wg.Wait()
+}
+
+func (p *HTTPPool) probe(peer string) error {
+	res, err := p.health.client.Get(peer + p.basePath + healthPath)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// 节点能够处理请求时返回200
+func (p *HTTPPool) serveHealth(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
+
+// 返回当前在哈希环上的节点 (包括自己)，按地址排序
+// 未开启健康检查时与 Peers 相同
+func (p *HTTPPool) HealthyPeers() []string {
+	peers := p.Peers()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	healthy := peers[:0]
+	for _, peer := range peers {
+		if st, ok := p.states[peer]; !ok || st.healthy {
+			healthy = append(healthy, peer)
+		}
+	}
+	return healthy
+}
+
+// 停止后台的健康检查
+func (p *HTTPPool) Close() error {
+	p.closeOnce.Do(func() {
+		if p.stop != nil {
+			close(p.stop)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,118 @@
+package wangcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 启动一个可以模拟宕机的节点，down 不为0时所有请求都返回503
+func newFlakyPeer(t *testing.T, down *int32) *httptest.Server {
+	pool := NewHTTPPool("http://flaky")
+	pool.Set("http://flaky")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(down) != 0 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		pool.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPassiveEjection(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	pool := NewHTTPPool("http://self", WithHealthCheck(time.Hour, time.Second, 2, 1))
+	defer pool.Close()
+	pool.Set("http://self", "http://other", dead.URL)
+
+	key := "key0"
+	for i := 1; pool.peers.Get(key) != dead.URL; i++ {
+		key = "key" + strconv.Itoa(i)
+	}
+	peer, _ := pool.PickPeer(key)
+	for i := 0; i < 2; i++ {
+		if _, err := peer.Get("scores", key); err == nil {
+			t.Fatalf("expect an error from the dead peer")
+		}
+	}
+	if pool.peers.Get(key) == dead.URL {
+		t.Fatalf("expect the dead peer to be ejected after 2 failures")
+	}
+	if got := pool.HealthyPeers(); !reflect.DeepEqual(got, []string{"http://other", "http://self"}) {
+		t.Fatalf("unexpected healthy peers %v", got)
+	}
+
+	// 移除已经被移出哈希环的节点，不能影响其他节点
+	owner := func() map[string]string {
+		m := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			key := "key" + strconv.Itoa(i)
+			m[key] = pool.peers.Get(key)
+		}
+		return m
+	}
+	before := owner()
+	pool.RemovePeers(dead.URL)
+	if !reflect.DeepEqual(owner(), before) {
+		t.Fatalf("expect the ring to be unchanged after removing an ejected peer")
+	}
+}
+
+func TestHealthHysteresis(t *testing.T) {
+	var down int32
+	srv := newFlakyPeer(t, &down)
+
+	// 间隔足够长，由测试手动触发检查
+	pool := NewHTTPPool("http://self", WithHealthCheck(time.Hour, time.Second, 2, 3))
+	defer pool.Close()
+	pool.Set("http://self", srv.URL)
+	key := remoteKey(t, pool)
+
+	steps := []struct {
+		down    int32
+		healthy bool
+	}{
+		{1, true}, {0, true}, {1, true}, {1, false}, // 两次连续失败后移出
+		{0, false}, {0, false}, {1, false}, {0, false}, {0, false}, {0, true}, // 三次连续成功后加入
+	}
+	for i, step := range steps {
+		atomic.StoreInt32(&down, step.down)
+		pool.probeAll()
+		if _, ok := pool.PickPeer(key); ok != step.healthy {
+			t.Fatalf("step %d: expect healthy=%v, but got %v", i, step.healthy, ok)
+		}
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	var down int32
+	srv := newFlakyPeer(t, &down)
+
+	pool := NewHTTPPool("http://self", WithHealthCheck(10*time.Millisecond, time.Second, 1, 1))
+	defer pool.Close()
+	pool.Set("http://self", srv.URL)
+
+	wait := func(healthy bool) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if (len(pool.HealthyPeers()) == 2) == healthy {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("peer is not healthy=%v after 2s", healthy)
+	}
+
+	atomic.StoreInt32(&down, 1)
+	wait(false)
+	atomic.StoreInt32(&down, 0)
+	wait(true)
+}
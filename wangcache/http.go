@@ -1,14 +1,24 @@
 package wangcache
 
 import (
-	"7go/wangCache/wangcache/consistenthash"
+	"7go/wangCache/wangcache/logger"
+	"7go/wangCache/wangcache/placement"
+	"7go/wangCache/wangcache/trace"
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	url2 "net/url"
+	"sort"
 	"strings"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 //提供被其他节点访问的能力(基于http)
@@ -23,67 +33,330 @@ const (
 	defaultReplicas = 50
 )
 
+// 以下划线开头的路径为节点内部使用的接口，格式是 /<basepath>/_<name>/...
+// 获取某个group序列化后的布隆过滤器: /<basepath>/_bloom/<groupname>
+const bloomPath = "_bloom"
+
+// 批量获取同一个group中的多个key: POST /<basepath>/_batch/<groupname>
+// 请求体为 protobuf 格式的 BatchRequest，响应为 BatchResponse，其中的每个响应与请求中的key一一对应
+const batchPath = "_batch"
+
+// 查看和修改当前节点的集群成员: /<basepath>/_peers
+//   GET    返回所有节点，每行一个
+//   POST   添加节点，节点地址通过 peer 参数传递，可以有多个，如 ?peer=http://localhost:8004&peer=http://localhost:8005
+//   DELETE 移除节点，参数同上
+// 只修改收到请求的节点，扩缩容时需要对集群中的每个节点都调用一次
+// POST/DELETE 默认被拒绝，需要通过 WithPeersToken 开启，并在请求中带上 tokenHeader
+const peersPath = "_peers"
+
+// 通过 _peers 接口修改集群成员时携带的令牌，与 WithPeersToken 设置的值相同才会执行
+const tokenHeader = "X-Wangcache-Token"
+
+// 以 Prometheus 文本格式导出所有group的统计数据: GET /<basepath>/_metrics
+const metricsPath = "_metrics"
+
+// 节点之间转发的请求会带上该请求头，接收方直接在本地执行，不再路由，
+// 避免哈希环不一致 (或按负载选择节点时各节点看到的负载不同) 时请求被来回转发
+const forwardedHeader = "X-Wangcache-Forwarded"
+
+// DELETE 请求带上 scope=hot 参数时，只丢弃 hotCache 中的副本 (用于失效广播)
+const (
+	scopeParam = "scope"
+	scopeHot   = "hot"
+)
+
+// 请求体不是 protobuf 格式的 PUT 请求通过 ttl 参数指定过期时间(毫秒)，
+// 旧版本节点会忽略该参数，使用自己的过期时间
+const ttlParam = "ttl"
+
+// 获取请求带上调用方剩余的超时时间(毫秒)，接收方以此作为本次加载的超时时间，
+// 避免调用方已经放弃等待后，远程节点仍然在回源查询
+const timeoutHeader = "X-Wangcache-Timeout"
+
+// 新版本节点的所有响应都会带上该响应头，值为支持的协议版本号，
+// 客户端据此判断对方是否支持 protobuf 格式的消息 (旧版本节点只支持直接传输缓存值本身)
+const versionHeader = "X-Wangcache-Version"
+
+// 节点间通过响应头传递错误类型，用于区分 "key不存在" 与 "group不存在" 等其他404情况
+// 使用 protobuf 格式时通过 Response.ErrorKind 区分，该响应头只为了兼容旧版本节点
+const (
+	errorHeader   = "X-Wangcache-Error"
+	errorNotFound = "not-found"
+)
+
 type HTTPPool struct {
 	self        string   // 用来记录自己的地址，包括主机名/IP和端口
 	basePath    string   // 作为节点间通讯地址的前缀，默认是 /_wangcache/
 	mu          sync.Mutex
-	peers       *consistenthash.Map  // 一致性哈希算法的Map，用来根据具体的 key选择节点
+	peers       placement.Placement  // 节点放置算法 (默认是一致性哈希)，用来根据具体的 key选择节点
+	newPlacement func() placement.Placement  // 重建 peers 时使用
+	weights     map[string]int  // 节点的权重，没有配置的节点权重为1
 	httpGetters map[string]*httpGetter   // 映射远程节点与对应的httpGetter
+	health      *healthConfig  // 健康检查的配置，nil 表示不检查
+	states      map[string]*peerState  // 远程节点的健康状态
+	stop        chan struct{}  // 关闭后停止后台的健康检查
+	closeOnce   sync.Once
+	registry    *Registry  // 处理请求时从这里查找group，默认是 DefaultRegistry
+	logger      logger.Logger  // 默认不输出日志
+	peersToken  string  // 通过 _peers 接口修改集群成员需要的令牌，为空时不允许修改
 }
 
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+// HTTPPool 的可选配置项，在 NewHTTPPool 时传入
+type HTTPPoolOption func(*HTTPPool)
+
+// WithPeerWeights 按节点地址设置权重，节点分配到的key的数量与权重成正比，没有配置的节点权重为1
+// 适用于机器内存大小不同的集群，如 {"http://localhost:8001": 2} 表示该节点承担两倍的key
+// 需要放置算法实现 placement.Weighted 接口 (默认的一致性哈希支持)，否则权重被忽略
+func WithPeerWeights(weights map[string]int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.weights = make(map[string]int, len(weights))
+		for peer, weight := range weights {
+			p.weights[peer] = weight
+		}
+	}
+}
+
+// WithPlacement 设置选择节点的放置算法，newPlacement 在每次重建节点列表 (Set) 时调用
+// 默认使用带 50 倍虚拟节点的一致性哈希，可以选择 placement 包中的其他算法，如:
+//   wangcache.WithPlacement(func() placement.Placement { return placement.NewRendezvous() })
+// placement.Jump 增删节点时大部分key都会移动，只适合通过 Set 设置固定节点的集群，
+// 不要与 AddPeers/RemovePeers (gossip、_peers 接口) 或健康检查一起使用
+func WithPlacement(newPlacement func() placement.Placement) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.newPlacement = newPlacement
+	}
+}
+
+// WithRegistry 设置处理请求时查找group的 Registry，默认是 DefaultRegistry
+// 同一个进程中的多个节点 (比如测试中) 使用各自的 Registry 才能互不干扰
+func WithRegistry(r *Registry) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.registry = r
+	}
+}
+
+// WithPeersToken 允许通过 _peers 接口添加和移除节点，请求需要带上 X-Wangcache-Token: <token> 请求头
+// 默认 _peers 接口只能查看节点 (token 为空时同样如此)，避免任何能访问缓存端口的人都可以修改哈希环
+func WithPeersToken(token string) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.peersToken = token
+	}
+}
+
+// WithPoolLogger 设置输出日志的 Logger，默认不输出任何日志
+// 选择节点、处理请求的日志为 Debug 级别；放置算法实现了 logger.Setter 时 (如默认的一致性哈希) 也使用该 Logger
+func WithPoolLogger(l logger.Logger) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.logger = l
+	}
+}
+
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
 		self:     self,
 		basePath: defaultBasePath,
+		registry: DefaultRegistry,
+		logger:   logger.Nop,
+		states:   make(map[string]*peerState),
+		newPlacement: func() placement.Placement {
+			return placement.NewRing(defaultReplicas)
+		},
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	if p.health != nil {
+		p.stop = make(chan struct{})
+		go p.checkHealth()
+	}
+	return p
 }
 
+// 重新设置集群中的所有节点，会重建整个哈希环
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	// 添加节点
-	p.peers.Add(peers...)
+	p.peers = p.placement()
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	// 仍在集群中的节点保留原来的健康状态
+	states := p.states
+	p.states = make(map[string]*peerState, len(peers))
 	for _, peer := range peers {
+		if st, ok := states[peer]; ok {
+			p.states[peer] = st
+		}
+		// 添加节点
+		p.admit(peer)
 		// 为每一个节点创建一个HTTP客户端 httpGetter
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		p.httpGetters[peer] = p.newGetter(peer)
 	}
 }
 
+// 新建放置算法，并设置它的 Logger，调用时需要持有 p.mu
+func (p *HTTPPool) placement() placement.Placement {
+	peers := p.newPlacement()
+	if setter, ok := peers.(logger.Setter); ok {
+		setter.SetLogger(p.logger)
+	}
+	return peers
+}
+
+// 将节点加入放置算法，配置了权重时按权重添加，调用时需要持有 p.mu
+func (p *HTTPPool) place(peer string) {
+	if weight, ok := p.weights[peer]; ok {
+		if weighted, ok := p.peers.(placement.Weighted); ok {
+			weighted.AddWeighted(peer, weight)
+			return
+		}
+	}
+	p.peers.Add(peer)
+}
+
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	h := &httpGetter{baseURL: peer + p.basePath, peer: peer}
+	if tracker, ok := p.peers.(placement.LoadTracker); ok {
+		// 放置算法需要知道每个节点的负载
+		h.load = tracker
+	}
+	if p.health != nil && peer != p.self {
+		// 访问节点的结果用于被动健康检查
+		h.report = func(err error) {
+			p.report(peer, err)
+		}
+	}
+	return h
+}
+
+// 向哈希环中添加节点，已经存在的节点会被忽略
+// 只会新增这些节点对应的虚拟节点，其他节点负责的key不会发生变化
+func (p *HTTPPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		p.peers = p.placement()
+		p.httpGetters = make(map[string]*httpGetter, len(peers))
+	}
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		p.admit(peer)
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+}
+
+// 从哈希环中移除节点，不存在的节点会被忽略
+// 被移除节点负责的key会转移到哈希环上的下一个节点，其他key不受影响
+func (p *HTTPPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; !ok {
+			continue
+		}
+		p.forget(peer)
+		delete(p.httpGetters, peer)
+	}
+}
+
+// 返回集群中的所有节点 (包括自己)，按地址排序
+func (p *HTTPPool) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peers := make([]string, 0, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
 // 包装了一致性哈希算法的 Get()方法，根据具体的 key，选择节点，返回节点对应的 HTTP 客户端
 // 实现PeerPicker接口
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	// 还没有设置任何节点
+	if p.peers == nil {
+		return nil, false
+	}
+
 	// 使用一致性hash算法根据key获取节点
 	peer := p.peers.Get(key)
 	// 如果返回的节点是自己(当前节点)，说明这个key就是由当前节点负责处理(包括缓存值的获取和存储)
 	// 所以不需要返回对应的httpGetter，因为key对应的缓存需要在当前节点中获取，不再需要请求其他节点
 	if peer != "" && peer != p.self {
-		log.Printf("[Server %s] select node is (%s)", p.self, peer)
+		p.logger.Debug("pick peer", "key", key, "peer", peer)
 		return p.httpGetters[peer], true
 	}
-	// 该判断和输出主要是为了调试，无具体逻辑意义
-	if peer == p.self {
-		log.Printf("select node is self")
-	}
-	// 条件成立则说明当前哈希环上没有任何节点 (即所有cacheServer节点都挂掉了，但目前这个系统没有考虑缓存服务器宕机的情况以及相应的处理)
+	// 条件成立则说明当前哈希环上没有任何节点 (开启健康检查时，可能是所有远程节点都被移出了哈希环，且自己也不在环上)
 	if peer == "" {
-		log.Printf("select node is null, there is no node to be selected.")
+		p.logger.Debug("no peer to pick", "key", key)
 	}
 
 	return nil, false
 }
 
+// 根据具体的 key，选择负责该key的 n 个节点，返回其中远程节点对应的 HTTP 客户端
+// 实现ReplicaPicker接口
+func (p *HTTPPool) PickReplicas(key string, n int) ([]PeerGetter, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		return nil, -1
+	}
+
+	return p.getters(p.peers.GetN(key, n))
+}
+
+// 根据具体的 key，选择真正负责该key的 n 个节点，放置算法实现了 placement.Owned 时不考虑节点的负载
+// 实现OwnerPicker接口
+func (p *HTTPPool) PickOwners(key string, n int) ([]PeerGetter, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		return nil, -1
+	}
+	if owned, ok := p.peers.(placement.Owned); ok {
+		return p.getters(owned.Owners(key, n))
+	}
+	return p.getters(p.peers.GetN(key, n))
+}
+
+// 返回节点中远程节点对应的 HTTP 客户端，以及当前节点的位置，调用时需要持有 p.mu
+func (p *HTTPPool) getters(nodes []string) ([]PeerGetter, int) {
+	self := -1
+	peers := make([]PeerGetter, 0, len(nodes))
+	for i, node := range nodes {
+		if node == p.self {
+			self = i
+			continue
+		}
+		peers = append(peers, p.httpGetters[node])
+	}
+	return peers, self
+}
+
 //确保这个类型(*HTTPPool)实现了这个接口(PeerPicker) 如果没有实现会报错的
 //var _ PeerPicker = (*HTTPPool)(nil)
 
 
+// 返回当前节点的地址
+// 实现SelfIdentifier接口
+func (p *HTTPPool) Self() string {
+	return p.self
+}
+
+// 以 Info 级别输出一条日志，带上当前节点的地址
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	p.logger.Info(fmt.Sprintf(format, v...), "self", p.self)
 }
 
 // 实现http的Handler接口，处理所有的http请求
@@ -93,27 +366,79 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
 
-	p.Log("%s %s", r.Method, r.URL.Path)
+	start := time.Now()
+	defer func() {
+		p.logger.Debug("serve request", "method", r.Method, "path", r.URL.Path, "latency", time.Since(start))
+	}()
+	w.Header().Set(versionHeader, strconv.Itoa(pb.Version))
+
+	switch path := strings.TrimSuffix(r.URL.Path[len(p.basePath):], "/"); path {
+	case peersPath:
+		p.servePeers(w, r)
+		return
+	case healthPath:
+		p.serveHealth(w)
+		return
+	case metricsPath:
+		p.serveMetrics(w)
+		return
+	}
 
 	// 切割出url后面的部分，约定格式是 <groupname>/<key>
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeError(w, r, pb.ErrorKind_BAD_REQUEST, "bad request")
+		return
+	}
+
+	switch parts[0] {
+	case bloomPath:
+		p.serveBloomFilter(w, parts[1])
+		return
+	case batchPath:
+		p.serveBatch(w, r, parts[1])
 		return
 	}
 
 	groupName := parts[0]
 	key := parts[1]
 
-	group := GetGroup(groupName)
+	group := p.registry.GetGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group: " + groupName, http.StatusNotFound)
+		writeError(w, r, pb.ErrorKind_NO_SUCH_GROUP, "no such group: " + groupName)
 		return
 	}
 
-	view, err := group.Get(key)
+	// PUT 设置缓存值，DELETE 删除缓存值，其他请求均视为获取缓存值
+	switch r.Method {
+	case http.MethodPut:
+		p.serveSet(w, r, group, key)
+		return
+	case http.MethodDelete:
+		p.serveRemove(w, r, group, key)
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	view, err := group.get(ctx, key, r.Header.Get(forwardedHeader) == "")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, ErrNotFound) {
+			writeError(w, r, pb.ErrorKind_NOT_FOUND, err.Error())
+			return
+		}
+		writeError(w, r, pb.ErrorKind_INTERNAL, err.Error())
+		return
+	}
+
+	// 客户端支持 protobuf 时返回带有元数据的响应，否则只返回缓存值本身
+	if acceptsProto(r) {
+		res := &pb.Response{Version: pb.Version, Group: groupName, Key: key, Value: view.b}
+		if !view.e.IsZero() {
+			// 剩余的过期时间，至少为1毫秒，避免被当作永不过期
+			res.Ttl = time.Until(view.e).Milliseconds() + 1
+		}
+		writeProto(w, http.StatusOK, res)
 		return
 	}
 
@@ -127,8 +452,262 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "the length of send data is not equal than the length of view", http.StatusInternalServerError)
 		return
 	}
+}
+
+// 请求的 context，客户端断开连接时取消；带有 timeoutHeader 时设置对应的超时时间
+// 带有 traceparent 请求头时，之后的 span 作为调用方 span 的子 span
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := trace.Extract(r.Context(), r.Header)
+	ms, err := strconv.ParseInt(r.Header.Get(timeoutHeader), 10, 64)
+	if err != nil || ms <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(ms) * time.Millisecond)
+}
+
+// 客户端是否接受 protobuf 格式的响应
+func acceptsProto(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), pb.ContentType)
+}
+
+func writeProto(w http.ResponseWriter, status int, res *pb.Response) {
+	data, err := res.Marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", pb.ContentType)
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// 返回错误，根据客户端是否支持 protobuf 选择响应格式
+func writeError(w http.ResponseWriter, r *http.Request, kind pb.ErrorKind, msg string) {
+	status := http.StatusInternalServerError
+	switch kind {
+	case pb.ErrorKind_NOT_FOUND, pb.ErrorKind_NO_SUCH_GROUP:
+		status = http.StatusNotFound
+	case pb.ErrorKind_BAD_REQUEST:
+		status = http.StatusBadRequest
+	}
+
+	if kind == pb.ErrorKind_NOT_FOUND {
+		w.Header().Set(errorHeader, errorNotFound)
+	}
+	if acceptsProto(r) {
+		writeProto(w, status, &pb.Response{Version: pb.Version, ErrorKind: kind, Error: msg})
+		return
+	}
+	http.Error(w, msg, status)
+}
+
+// 设置缓存值，请求体为 protobuf 格式的 Request (可以带上过期时间)，或者是缓存值本身 (过期时间通过 ttl 参数指定)
+// 没有指定过期时间时使用 group 的过期时间
+// 来自其他节点转发的请求直接在本地设置，否则按照一致性哈希路由到负责该key的节点
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	value, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ms int64
+	if r.Header.Get("Content-Type") == pb.ContentType {
+		req := new(pb.Request)
+		if err := req.Unmarshal(value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		value, ms = req.Value, req.Ttl
+	} else if s := r.URL.Query().Get(ttlParam); s != "" {
+		if ms, err = strconv.ParseInt(s, 10, 64); err != nil {
+			http.Error(w, "invalid ttl: " + s, http.StatusBadRequest)
+			return
+		}
+	}
+	ttl := time.Duration(ms) * time.Millisecond
+
+	if r.Header.Get(forwardedHeader) != "" {
+		group.setLocally(key, ByteView{b: value, e: group.expireAfter(ttl)})
+	} else if err := group.SetWithTTL(key, value, ttl); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 删除缓存值
+// scope=hot 时只丢弃 hotCache 中的副本；来自其他节点转发的请求直接在本地删除；否则路由到负责该key的节点
+func (p *HTTPPool) serveRemove(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	if r.URL.Query().Get(scopeParam) == scopeHot {
+		group.hotCache.remove(key)
+	} else if r.Header.Get(forwardedHeader) != "" {
+		group.removeLocally(key)
+	} else if err := group.Remove(key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 返回除自己以外的所有节点对应的 httpGetter
+// 实现PeerLister接口
+func (p *HTTPPool) ListPeers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peers := make([]PeerGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+// 查看和修改集群成员，返回修改后的所有节点
+func (p *HTTPPool) servePeers(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	peers := r.Form["peer"]
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		if !p.authorize(w, r) {
+			return
+		}
+		if len(peers) == 0 {
+			http.Error(w, "no peer specified", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			p.Log("add peers %v", peers)
+			p.AddPeers(peers...)
+		} else {
+			p.Log("remove peers %v", peers)
+			p.RemovePeers(peers...)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	log.Printf("node [%s]: get cache successfully.", p.self)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, peer := range p.Peers() {
+		fmt.Fprintln(w, peer)
+	}
+}
+
+// 检查修改集群成员的请求是否带有正确的令牌，没有配置令牌时拒绝所有修改
+func (p *HTTPPool) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if p.peersToken == "" {
+		http.Error(w, "modifying peers is disabled", http.StatusForbidden)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(tokenHeader)), []byte(p.peersToken)) != 1 {
+		p.logger.Warn("rejected request to modify peers", "self", p.self, "remote", r.RemoteAddr)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// 批量获取多个key，各个key的结果通过对应 Response 的 ErrorKind 区分
+func (p *HTTPPool) serveBatch(w http.ResponseWriter, r *http.Request, groupName string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, r, pb.ErrorKind_BAD_REQUEST, "method not allowed")
+		return
+	}
+	group := p.registry.GetGroup(groupName)
+	if group == nil {
+		writeError(w, r, pb.ErrorKind_NO_SUCH_GROUP, "no such group: " + groupName)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, pb.ErrorKind_BAD_REQUEST, err.Error())
+		return
+	}
+	req := new(pb.BatchRequest)
+	if err := req.Unmarshal(body); err != nil {
+		writeError(w, r, pb.ErrorKind_BAD_REQUEST, err.Error())
+		return
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	res := &pb.BatchResponse{Version: pb.Version, Responses: make([]*pb.Response, len(req.Keys))}
+	for i, result := range group.getMulti(ctx, req.Keys, r.Header.Get(forwardedHeader) == "") {
+		out := &pb.Response{Version: pb.Version, Group: groupName, Key: req.Keys[i]}
+		switch {
+		case result.Err == nil:
+			out.Value = result.Value.b
+			if !result.Value.e.IsZero() {
+				// 剩余的过期时间，至少为1毫秒，避免被当作永不过期
+				out.Ttl = time.Until(result.Value.e).Milliseconds() + 1
+			}
+		case errors.Is(result.Err, ErrNotFound):
+			out.ErrorKind, out.Error = pb.ErrorKind_NOT_FOUND, result.Err.Error()
+		default:
+			out.ErrorKind, out.Error = pb.ErrorKind_INTERNAL, result.Err.Error()
+		}
+		res.Responses[i] = out
+	}
+
+	data, err := res.Marshal()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", pb.ContentType)
+	w.Write(data)
+}
+
+// 返回指定group序列化后的布隆过滤器
+func (p *HTTPPool) serveBloomFilter(w http.ResponseWriter, groupName string) {
+	group := p.registry.GetGroup(groupName)
+	if group == nil {
+		http.Error(w, "no such group: " + groupName, http.StatusNotFound)
+		return
+	}
+
+	data, err := group.BloomFilter()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+// 从其他所有节点拉取 group 的布隆过滤器，并合并到本地
+func (p *HTTPPool) SyncBloomFilter(group *Group) error {
+	p.mu.Lock()
+	getters := make([]*httpGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, getter := range getters {
+		data, err := getter.getBloomFilter(group.name)
+		if err != nil {
+			return err
+		}
+		if err := group.MergeBloomFilter(data); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 
@@ -141,19 +720,256 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 type httpGetter struct {
 	baseURL string  // 表示将要访问的远程节点的地址
+	proto   int32   // 远程节点是否支持 protobuf 格式的消息，收到过带 versionHeader 的响应后置为1
+	report  func(err error)  // 开启健康检查时，记录每次访问节点的结果
+	peer    string  // 节点的地址
+	load    placement.LoadTracker  // 放置算法需要节点负载时，记录正在进行的请求数
+}
+
+// 节点的地址，用于日志
+func (h *httpGetter) String() string {
+	return h.peer
+}
+
+// 发送请求，网络错误会被记录为节点的一次失败，收到任何响应都说明节点可以访问
+// 因为调用方取消或超时而失败的请求不计入节点的健康状态
+func (h *httpGetter) do(req *http.Request) (*http.Response, error) {
+	if h.load != nil {
+		h.load.Inc(h.peer)
+		defer h.load.Done(h.peer)
+	}
+	setTimeout(req)
+	trace.Inject(req.Context(), req.Header)
+	res, err := http.DefaultClient.Do(req)
+	if h.report != nil && req.Context().Err() == nil {
+		h.report(err)
+	}
+	return res, err
+}
+
+// ctx 带有截止时间时，通过 timeoutHeader 把剩余的超时时间告诉远程节点
+func setTimeout(req *http.Request) {
+	deadline, ok := req.Context().Deadline()
+	if !ok {
+		return
+	}
+	// 至少为1毫秒，0 会被远程节点当作不限制
+	req.Header.Set(timeoutHeader, strconv.FormatInt(time.Until(deadline).Milliseconds() + 1, 10))
 }
 
 // 使用http.get访问指定的远程节点获取group和key对应的缓存数据
 // 实现PeerGetter接口
 func (h *httpGetter) Get(group string, key string) ([]byte, error) {
+	return h.GetContext(context.Background(), group, key)
+}
+
+// 实现ContextPeerGetter接口
+func (h *httpGetter) GetContext(ctx context.Context, group string, key string) ([]byte, error) {
+	out := new(pb.Response)
+	if err := h.FetchContext(ctx, &pb.Request{Version: pb.Version, Group: group, Key: key}, out); err != nil {
+		return nil, err
+	}
+	return out.Value, nil
+}
+
+// 获取缓存值以及过期时间等元数据
+// 请求时声明接受 protobuf 格式，旧版本节点会忽略它并直接返回缓存值本身，两种响应都可以正确处理
+// 实现PeerFetcher接口
+func (h *httpGetter) Fetch(in *pb.Request, out *pb.Response) error {
+	return h.FetchContext(context.Background(), in, out)
+}
+
+// 实现ContextPeerFetcher接口
+func (h *httpGetter) FetchContext(ctx context.Context, in *pb.Request, out *pb.Response) error {
 	// 拼装请求的url
-	url := fmt.Sprintf(
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url(in.Group, in.Key), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", pb.ContentType)
+	req.Header.Set(forwardedHeader, "1")
+
+	res, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	h.observe(res)
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body failed, error: %v", err)
+	}
+
+	if res.Header.Get("Content-Type") == pb.ContentType {
+		if err := out.Unmarshal(data); err != nil {
+			return fmt.Errorf("decoding response body failed, error: %v", err)
+		}
+		return responseError(out)
+	}
+
+	// 旧版本节点的响应
+	if res.StatusCode == http.StatusNotFound && res.Header.Get(errorHeader) == errorNotFound {
+		return ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	*out = pb.Response{Group: in.Group, Key: in.Key, Value: data}
+	return nil
+}
+
+// 将 Response 中的错误转换为 error
+func responseError(out *pb.Response) error {
+	switch out.ErrorKind {
+	case pb.ErrorKind_NONE:
+		return nil
+	case pb.ErrorKind_NOT_FOUND:
+		return ErrNotFound
+	default:
+		return fmt.Errorf("server returned: %v, %s", out.ErrorKind, out.Error)
+	}
+}
+
+// 一次请求获取同一个group中的多个key，返回的响应与 keys 一一对应
+// 单个key的错误记录在对应 Response 的 ErrorKind 中，只有请求本身失败时才返回 error (比如旧版本节点不支持批量接口)
+// 实现PeerBatchGetter接口
+func (h *httpGetter) GetBatch(group string, keys []string) ([]*pb.Response, error) {
+	return h.GetBatchContext(context.Background(), group, keys)
+}
+
+// 实现ContextPeerBatchGetter接口
+func (h *httpGetter) GetBatchContext(ctx context.Context, group string, keys []string) ([]*pb.Response, error) {
+	body, err := (&pb.BatchRequest{Version: pb.Version, Group: group, Keys: keys}).Marshal()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.baseURL + batchPath + "/" + url2.QueryEscape(group), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", pb.ContentType)
+	req.Header.Set("Accept", pb.ContentType)
+	req.Header.Set(forwardedHeader, "1")
+
+	res, err := h.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	h.observe(res)
+
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != pb.ContentType {
+		return nil, fmt.Errorf("server returned: %v", res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response body failed, error: %v", err)
+	}
+
+	out := new(pb.BatchResponse)
+	if err := out.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("decoding response body failed, error: %v", err)
+	}
+	if len(out.Responses) != len(keys) {
+		return nil, fmt.Errorf("expect %d responses, but got %d", len(keys), len(out.Responses))
+	}
+	return out.Responses, nil
+}
+
+// 根据响应头记录远程节点是否支持 protobuf 格式的消息
+func (h *httpGetter) observe(res *http.Response) {
+	if res.Header.Get(versionHeader) != "" {
+		atomic.StoreInt32(&h.proto, 1)
+	}
+}
+
+// 设置远程节点上的缓存值
+// 远程节点支持 protobuf 时请求体为 Request 消息，否则为缓存值本身，过期时间通过 ttl 参数传递
+// 实现PeerSetter接口
+func (h *httpGetter) Set(group string, key string, value []byte) error {
+	return h.SetWithTTL(group, key, value, 0)
+}
+
+// 设置远程节点上的缓存值，经过 ttl 后过期，不足1毫秒按1毫秒计算
+// 实现PeerTTLSetter接口
+func (h *httpGetter) SetWithTTL(group string, key string, value []byte, ttl time.Duration) error {
+	var ms int64
+	if ttl > 0 {
+		ms = int64((ttl + time.Millisecond - 1) / time.Millisecond)
+	}
+	return h.set(&pb.Request{Version: pb.Version, Group: group, Key: key, Value: value, Ttl: ms})
+}
+
+func (h *httpGetter) set(in *pb.Request) error {
+	if atomic.LoadInt32(&h.proto) == 0 {
+		url := h.url(in.Group, in.Key)
+		if in.Ttl > 0 {
+			url += "?" + ttlParam + "=" + strconv.FormatInt(in.Ttl, 10)
+		}
+		return h.send(http.MethodPut, url, "", in.Value)
+	}
+	body, err := in.Marshal()
+	if err != nil {
+		return err
+	}
+	return h.send(http.MethodPut, h.url(in.Group, in.Key), pb.ContentType, body)
+}
+
+// 删除远程节点上的缓存值
+// 实现PeerRemover接口
+func (h *httpGetter) Remove(group string, key string) error {
+	return h.send(http.MethodDelete, h.url(group, key), "", nil)
+}
+
+// 通知远程节点丢弃 hotCache 中的副本
+// 实现PeerInvalidator接口
+func (h *httpGetter) Invalidate(group string, key string) error {
+	return h.send(http.MethodDelete, h.url(group, key) + "?" + scopeParam + "=" + scopeHot, "", nil)
+}
+
+func (h *httpGetter) url(group string, key string) string {
+	return fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
 		url2.QueryEscape(group),
 		url2.QueryEscape(key))
+}
+
+// 发送写请求，这些请求都是节点之间转发的，所以都带上 forwardedHeader
+func (h *httpGetter) send(method string, url string, contentType string, body []byte) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(forwardedHeader, "1")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	h.observe(res)
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("server returned: %v, %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
 
-	res, err := http.Get(url)
+// 获取远程节点上指定group序列化后的布隆过滤器
+func (h *httpGetter) getBloomFilter(group string) ([]byte, error) {
+	url := fmt.Sprintf("%v%v/%v", h.baseURL, bloomPath, url2.QueryEscape(group))
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,533 @@
+package wangcache
+
+import (
+	"7go/wangCache/wangcache/bloom"
+	"7go/wangCache/wangcache/placement"
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 启动一个只包含自己的节点来服务指定的group，返回访问该节点的httpGetter
+func newTestPeer(t *testing.T, groups ...*Group) *httpGetter {
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self")
+	for _, g := range groups {
+		g.RegisterPeers(pool)
+	}
+
+	srv := httptest.NewServer(pool)
+	t.Cleanup(srv.Close)
+	return &httpGetter{baseURL: srv.URL + defaultBasePath}
+}
+
+func TestHTTPGetterNotFound(t *testing.T) {
+	group := NewGroup("http-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("key [%s]: %w", key, ErrNotFound)
+	}))
+	peer := newTestPeer(t, group)
+
+	data, err := peer.Get("http-scores", "Tom")
+	if err != nil || string(data) != db["Tom"] {
+		t.Fatalf("failed to get Tom from peer, err: %v", err)
+	}
+
+	if _, err := peer.Get("http-scores", "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound for unknown key, but got %v", err)
+	}
+
+	// group不存在时同样是404，但不能被当作key不存在
+	if _, err := peer.Get("no-such-group", "Tom"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect a non ErrNotFound error for unknown group, but got %v", err)
+	}
+}
+
+func TestSyncBloomFilter(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	})
+	remote := NewGroup("http-bloom", 2<<10, getter, WithBloomFilter(100, 0.01))
+	peer := newTestPeer(t, remote)
+	seeded := false
+	remote.SeedBloomFilter(func() (string, bool) {
+		if seeded {
+			return "", false
+		}
+		seeded = true
+		return "Tom", true
+	})
+
+	// 本地节点使用相同的参数创建布隆过滤器，从远程节点同步后即可感知到 Tom
+	local := &Group{name: "http-bloom", filter: &keyFilter{filter: bloom.New(100, 0.01)}}
+	if local.filter.mayContain("Tom") {
+		t.Fatalf("Tom should not be in the local filter before sync")
+	}
+
+	pool := NewHTTPPool("http://local")
+	pool.httpGetters = map[string]*httpGetter{"http://remote": peer}
+	if err := pool.SyncBloomFilter(local); err != nil {
+		t.Fatalf("failed to sync bloom filter, err: %v", err)
+	}
+	if !local.filter.mayContain("Tom") {
+		t.Fatalf("Tom should be in the local filter after sync")
+	}
+}
+
+// 返回一个由远程节点负责的key
+func remoteKey(t *testing.T, pool *HTTPPool) string {
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if _, ok := pool.PickPeer(key); ok {
+			return key
+		}
+	}
+	t.Fatalf("no key is owned by remote peer")
+	return ""
+}
+
+func TestHotCache(t *testing.T) {
+	var requests int32
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("630"))
+	}))
+	defer remote.Close()
+
+	group := NewGroup("http-hot", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		t.Fatalf("key [%s] should be loaded from remote peer", key)
+		return nil, nil
+	}))
+	// 每次从远程节点获取到的值都保存到 hotCache
+	group.hotOdds = 1
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", remote.URL)
+	group.RegisterPeers(pool)
+
+	key := remoteKey(t, pool)
+	for i := 0; i < 3; i++ {
+		if view, err := group.Get(key); err != nil || view.String() != "630" {
+			t.Fatalf("failed to get %s from remote peer, err: %v", key, err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expect 1 request to remote peer, but got %d", n)
+	}
+	if _, ok := group.mainCache.get(key); ok {
+		t.Fatalf("key owned by remote peer should not be populated into mainCache")
+	}
+
+	// cacheBytes 太小，分配给 hotCache 的内存为0时不使用 hotCache，而不是不限制大小
+	small := NewGroup("http-hot-small", 7, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}))
+	small.hotOdds = 1
+	small.RegisterPeers(pool)
+	for i := 0; i < 10; i++ {
+		small.populatePeerValue("key" + strconv.Itoa(i), ByteView{b: []byte("630")})
+	}
+	if items, _, _ := small.hotCache.stats(); items != 0 {
+		t.Fatalf("expect hotCache to be disabled, but got %d items", items)
+	}
+}
+
+func TestServeSetAndRemove(t *testing.T) {
+	group := NewGroup("http-set", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	peer := newTestPeer(t, group)
+
+	// 不带 forwardedHeader 的请求会先路由，这里只有一个节点，所以最终在本地生效
+	req, _ := http.NewRequest(http.MethodPut, peer.url("http-set", "Tom"), strings.NewReader("700"))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil || res.StatusCode != http.StatusNoContent {
+		t.Fatalf("failed to put Tom, err: %v", err)
+	}
+	res.Body.Close()
+	if data, err := peer.Get("http-set", "Tom"); err != nil || string(data) != "700" {
+		t.Fatalf("expect Tom=700 after put, but got %s, err: %v", data, err)
+	}
+
+	if err := peer.Remove("http-set", "Tom"); err != nil {
+		t.Fatalf("failed to remove Tom, err: %v", err)
+	}
+	if data, err := peer.Get("http-set", "Tom"); err != nil || string(data) != db["Tom"] {
+		t.Fatalf("expect Tom to be reloaded after remove, but got %s, err: %v", data, err)
+	}
+}
+
+func TestSetRoutesToOwner(t *testing.T) {
+	var mu sync.Mutex
+	requests := make([]string, 0)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, fmt.Sprintf("%s %s %s %s", r.Method, r.URL.RawQuery, r.Header.Get(forwardedHeader), body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer remote.Close()
+
+	group := NewGroup("http-route", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), WithBroadcastInvalidation())
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", remote.URL)
+	group.RegisterPeers(pool)
+
+	key := remoteKey(t, pool)
+	if err := group.Set(key, []byte("700")); err != nil {
+		t.Fatalf("failed to set %s, err: %v", key, err)
+	}
+	if err := group.Remove(key); err != nil {
+		t.Fatalf("failed to remove %s, err: %v", key, err)
+	}
+
+	// 写操作转发给负责该key的节点，随后广播 hotCache 失效
+	expect := []string{
+		"PUT  1 700",
+		"DELETE scope=hot 1 ",
+		"DELETE  1 ",
+		"DELETE scope=hot 1 ",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(expect, requests) {
+		t.Fatalf("expect requests %q, but got %q", expect, requests)
+	}
+}
+
+func TestProtoNegotiation(t *testing.T) {
+	group := NewGroup("http-proto", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("key [%s]: %w", key, ErrNotFound)
+	}), WithTTL(time.Minute, 0))
+	peer := newTestPeer(t, group)
+
+	// 新版本客户端：protobuf 格式，带有剩余的过期时间
+	out := new(pb.Response)
+	if err := peer.Fetch(&pb.Request{Version: pb.Version, Group: "http-proto", Key: "Tom"}, out); err != nil {
+		t.Fatalf("failed to fetch Tom, err: %v", err)
+	}
+	if string(out.Value) != db["Tom"] || out.Ttl <= 0 || out.Ttl > time.Minute.Milliseconds()+1 {
+		t.Fatalf("unexpected response %+v", out)
+	}
+	if atomic.LoadInt32(&peer.proto) != 1 {
+		t.Fatalf("peer should be marked as supporting protobuf")
+	}
+	if err := peer.Fetch(&pb.Request{Group: "http-proto", Key: "unknown"}, out); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, but got %v", err)
+	}
+
+	// 旧版本客户端：不声明接受 protobuf，只返回缓存值本身
+	res, err := http.Get(peer.url("http-proto", "Tom"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.Header.Get("Content-Type") != "application/octet-stream" || string(data) != db["Tom"] {
+		t.Fatalf("expect raw value for legacy client, but got %s", data)
+	}
+
+	// 支持 protobuf 的节点上，Set 请求体为 Request 消息
+	if err := peer.set(&pb.Request{Version: pb.Version, Group: "http-proto", Key: "Tom", Value: []byte("700"), Ttl: 1000}); err != nil {
+		t.Fatalf("failed to set Tom, err: %v", err)
+	}
+	if err := peer.Fetch(&pb.Request{Group: "http-proto", Key: "Tom"}, out); err != nil || string(out.Value) != "700" || out.Ttl > 1001 {
+		t.Fatalf("expect Tom=700 with ttl <= 1s, but got %+v, err: %v", out, err)
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	group := NewGroup("http-ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), WithTTL(time.Minute, 0))
+	peer := newTestPeer(t, group)
+
+	// 客户端直接发送的 PUT 请求 (不是其他节点转发的)，两种格式都可以指定过期时间
+	put := func(url string, contentType string, body []byte) {
+		req, _ := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNoContent {
+			t.Fatalf("expect %d, but got %s", http.StatusNoContent, res.Status)
+		}
+	}
+	body, _ := (&pb.Request{Version: pb.Version, Group: "http-ttl", Key: "Tom", Value: []byte("700"), Ttl: 1000}).Marshal()
+	put(peer.url("http-ttl", "Tom"), pb.ContentType, body)
+	put(peer.url("http-ttl", "Jack") + "?" + ttlParam + "=1000", "", []byte("800"))
+
+	// 不支持 protobuf 的节点之间转发时，同样通过 ttl 参数传递
+	raw := &httpGetter{baseURL: peer.baseURL}
+	if err := raw.SetWithTTL("http-ttl", "Sam", []byte("900"), time.Second); err != nil {
+		t.Fatalf("failed to set Sam, err: %v", err)
+	}
+	if err := group.Set("Lily", []byte("1000")); err != nil {
+		t.Fatalf("failed to set Lily, err: %v", err)
+	}
+
+	for key, expect := range map[string]string{"Tom": "700", "Jack": "800", "Sam": "900"} {
+		out := new(pb.Response)
+		if err := peer.Fetch(&pb.Request{Group: "http-ttl", Key: key}, out); err != nil || string(out.Value) != expect || out.Ttl <= 0 || out.Ttl > 1001 {
+			t.Fatalf("expect %s=%s with ttl <= 1s, but got %+v, err: %v", key, expect, out, err)
+		}
+	}
+	// 没有指定过期时间时使用 group 的过期时间
+	out := new(pb.Response)
+	if err := peer.Fetch(&pb.Request{Group: "http-ttl", Key: "Lily"}, out); err != nil || string(out.Value) != "1000" || out.Ttl <= 1001 {
+		t.Fatalf("expect Lily=1000 with the group ttl, but got %+v, err: %v", out, err)
+	}
+}
+
+func TestAddRemovePeers(t *testing.T) {
+	pool := NewHTTPPool("http://self")
+	pool.AddPeers("http://self", "http://a", "http://b")
+
+	owner := func() map[string]string {
+		m := make(map[string]string)
+		for i := 0; i < 1000; i++ {
+			key := "key" + strconv.Itoa(i)
+			m[key] = pool.peers.Get(key)
+		}
+		return m
+	}
+	getter := pool.httpGetters["http://a"]
+	before := owner()
+
+	// 新增节点时只有分配给新节点的key会移动，已有节点的 httpGetter 保持不变
+	pool.AddPeers("http://a", "http://c")
+	if pool.httpGetters["http://a"] != getter {
+		t.Fatalf("expect the getter of an existing peer to be kept")
+	}
+	for key, peer := range owner() {
+		if peer != before[key] && peer != "http://c" {
+			t.Fatalf("key %s moved from %s to %s after adding http://c", key, before[key], peer)
+		}
+	}
+
+	// 移除节点后恢复到原来的分配
+	pool.RemovePeers("http://c", "http://unknown")
+	if !reflect.DeepEqual(owner(), before) {
+		t.Fatalf("expect the ring to be restored after removing http://c")
+	}
+	if got := pool.Peers(); !reflect.DeepEqual(got, []string{"http://a", "http://b", "http://self"}) {
+		t.Fatalf("unexpected peers %v", got)
+	}
+
+	pool.RemovePeers("http://a", "http://b")
+	if _, ok := pool.PickPeer("Tom"); ok {
+		t.Fatalf("expect no remote peer after removing all of them")
+	}
+}
+
+// 请求 _peers 接口，token 不为空时带上 tokenHeader
+func doPeers(t *testing.T, srv *httptest.Server, method, query, token string) (int, string) {
+	req, _ := http.NewRequest(method, srv.URL + defaultBasePath + peersPath + query, nil)
+	if token != "" {
+		req.Header.Set(tokenHeader, token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, query, err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(body)
+}
+
+func TestServePeers(t *testing.T) {
+	pool := NewHTTPPool("http://self", WithPeersToken("secret"))
+	pool.Set("http://self")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	do := func(method, query string) (int, string) {
+		return doPeers(t, srv, method, query, "secret")
+	}
+
+	if code, body := do(http.MethodPost, "?peer=http://a&peer=http://b"); code != http.StatusOK || body != "http://a\nhttp://b\nhttp://self\n" {
+		t.Fatalf("unexpected response of adding peers: %d %q", code, body)
+	}
+	if _, ok := pool.PickPeer(remoteKey(t, pool)); !ok {
+		t.Fatalf("expect added peers to be picked")
+	}
+	if code, body := do(http.MethodDelete, "/?peer=http://a"); code != http.StatusOK || body != "http://b\nhttp://self\n" {
+		t.Fatalf("unexpected response of removing peers: %d %q", code, body)
+	}
+	if code, body := do(http.MethodGet, ""); code != http.StatusOK || body != "http://b\nhttp://self\n" {
+		t.Fatalf("unexpected response of listing peers: %d %q", code, body)
+	}
+	if code, _ := do(http.MethodPost, ""); code != http.StatusBadRequest {
+		t.Fatalf("expect 400 when no peer specified, but got %d", code)
+	}
+
+	// 令牌错误或缺失时拒绝修改
+	for _, token := range []string{"", "wrong"} {
+		if code, _ := doPeers(t, srv, http.MethodPost, "?peer=http://c", token); code != http.StatusUnauthorized {
+			t.Fatalf("expect 401 with token %q, but got %d", token, code)
+		}
+	}
+	if got := pool.Peers(); !reflect.DeepEqual(got, []string{"http://b", "http://self"}) {
+		t.Fatalf("expect peers not to be modified, but got %v", got)
+	}
+}
+
+// 没有配置令牌时 _peers 接口只能查看节点
+func TestServePeersReadOnly(t *testing.T) {
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", "http://a")
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	for _, method := range []string{http.MethodPost, http.MethodDelete} {
+		if code, _ := doPeers(t, srv, method, "?peer=http://a", "anything"); code != http.StatusForbidden {
+			t.Fatalf("expect 403 for %s, but got %d", method, code)
+		}
+	}
+	if code, body := doPeers(t, srv, http.MethodGet, "", ""); code != http.StatusOK || body != "http://a\nhttp://self\n" {
+		t.Fatalf("unexpected response of listing peers: %d %q", code, body)
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	newPlacements := map[string]func() placement.Placement{
+		"rendezvous": func() placement.Placement { return placement.NewRendezvous() },
+		"jump":       func() placement.Placement { return placement.NewJump() },
+		"bounded":    func() placement.Placement { return placement.NewBounded(defaultReplicas, 0) },
+	}
+	for name, newPlacement := range newPlacements {
+		remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("630"))
+		}))
+
+		pool := NewHTTPPool("http://self", WithPlacement(newPlacement))
+		pool.Set("http://self", remote.URL)
+		key := remoteKey(t, pool)
+		peer, _ := pool.PickPeer(key)
+		if data, err := peer.Get("scores", key); err != nil || string(data) != "630" {
+			t.Fatalf("%s: failed to get %s from remote peer, err: %v", name, key, err)
+		}
+		if _, ok := pool.peers.(placement.LoadTracker); ok && pool.httpGetters[remote.URL].load == nil {
+			t.Fatalf("%s: expect the load of peers to be tracked", name)
+		}
+		remote.Close()
+	}
+}
+
+// 按负载临时选择当前节点时，加载到的数据只保存在 hotCache，写操作仍然路由到真正负责该key的节点
+func TestBoundedOwnership(t *testing.T) {
+	var mu sync.Mutex
+	requests := make([]string, 0)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer remote.Close()
+
+	group := NewGroup("http-bounded", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}))
+	pool := NewHTTPPool("http://self", WithPlacement(func() placement.Placement {
+		return placement.NewBounded(defaultReplicas, 0)
+	}))
+	pool.Set("http://self", remote.URL)
+	group.RegisterPeers(pool)
+
+	// 远程节点过载，读请求被顺延到当前节点
+	key := remoteKey(t, pool)
+	bounded := pool.peers.(*placement.Bounded)
+	for i := 0; i < 10; i++ {
+		bounded.Inc(remote.URL)
+	}
+	if view, err := group.Get(key); err != nil || view.String() != "630" {
+		t.Fatalf("failed to get %s, err: %v", key, err)
+	}
+	if _, ok := group.mainCache.get(key); ok {
+		t.Fatalf("key owned by remote peer should not be populated into mainCache")
+	}
+	if _, ok := group.hotCache.get(key); !ok {
+		t.Fatalf("expect %s to be populated into hotCache", key)
+	}
+
+	if err := group.Set(key, []byte("700")); err != nil {
+		t.Fatalf("failed to set %s, err: %v", key, err)
+	}
+	if _, ok := group.hotCache.get(key); ok {
+		t.Fatalf("expect %s to be removed from hotCache after set", key)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(requests, []string{http.MethodPut}) {
+		t.Fatalf("expect set to be routed to the owner, but got %q", requests)
+	}
+}
+
+// 其他节点转发过来的读请求直接在本地加载，不再路由
+func TestServeForwardedGet(t *testing.T) {
+	var requests int32
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("remote"))
+	}))
+	defer remote.Close()
+
+	NewGroup("http-forwarded", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", remote.URL)
+	key := remoteKey(t, pool)
+
+	req := httptest.NewRequest(http.MethodGet, defaultBasePath + "http-forwarded/" + key, nil)
+	req.Header.Set(forwardedHeader, "1")
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, req)
+	if w.Body.String() != "local" || atomic.LoadInt32(&requests) != 0 {
+		t.Fatalf("expect forwarded request to be served locally, but got %q with %d remote requests", w.Body.String(), requests)
+	}
+}
+
+func TestPeerWeights(t *testing.T) {
+	pool := NewHTTPPool("http://self", WithPeerWeights(map[string]int{"http://big": 3}))
+	pool.Set("http://self", "http://big")
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[pool.peers.Get("key" + strconv.Itoa(i))]++
+	}
+	if ratio := float64(counts["http://big"]) / 10000; ratio < 0.65 || ratio > 0.85 {
+		t.Fatalf("expect about 75%% keys on http://big, but got %.2f", ratio)
+	}
+
+	// 移除带权重的节点后，所有的key都由自己负责
+	pool.RemovePeers("http://big")
+	for i := 0; i < 100; i++ {
+		if peer := pool.peers.Get("key" + strconv.Itoa(i)); peer != "http://self" {
+			t.Fatalf("expect all keys on http://self, but got %s", peer)
+		}
+	}
+}
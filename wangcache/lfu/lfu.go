@@ -0,0 +1,189 @@
+package lfu
+
+import (
+	"7go/wangCache/wangcache/policy"
+	"container/heap"
+	"time"
+)
+
+// Cache is a LFU cache. It is not safe for concurrent access.
+// 使用 lfu 缓存淘汰策略：淘汰访问次数最少的记录，访问次数相同时淘汰最久未被访问的记录
+type Cache struct {
+	maxBytes int64             // 缓存允许使用的最大字节数
+	nbytes   int64             // 当前已使用的字节数
+	queue    entryHeap         // 按 (访问次数, 最近访问时间) 排序的小顶堆，堆顶即为下一个被淘汰的记录
+	cache    map[string]*entry // 键是字符串，值是堆中对应的记录
+	clock    uint64            // 逻辑时钟，每次访问递增，用于访问次数相同时区分先后
+	// optional and executed when an entry is purged.
+	// 某条记录被移除时的回调函数，可以为 nil
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time // 过期时间，零值表示永不过期
+	freq   uint64    // 访问次数
+	tick   uint64    // 最近一次访问的逻辑时间
+	index  int       // 在堆中的下标，由 heap.Interface 维护
+}
+
+// 判断记录在 now 时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// Value use Len() to count how many bytes it takes
+type Value = policy.Value
+
+var _ policy.Cache = (*Cache)(nil)
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*entry),
+		OnEvicted: onEvicted,
+	}
+}
+
+// 获取缓存，命中时访问次数加一
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	e, ok := c.cache[key]
+	if ok {
+		if e.expired(time.Now()) {
+			c.removeEntry(e)
+			return nil, false
+		}
+		c.touch(e)
+		return e.value, ok
+	}
+	return
+}
+
+// 增加记录的访问次数，并调整其在堆中的位置
+func (c *Cache) touch(e *entry) {
+	c.clock++
+	e.freq++
+	e.tick = c.clock
+	heap.Fix(&c.queue, e.index)
+}
+
+// 移除访问次数最少的记录 (堆顶元素)
+func (c *Cache) RemoveLeastFrequent() {
+	if c.queue.Len() > 0 {
+		c.removeEntry(c.queue[0])
+	}
+}
+
+// 移除指定的缓存
+func (c *Cache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e)
+	}
+}
+
+// 清空所有缓存，每条记录都会触发回调函数
+func (c *Cache) Purge() {
+	for c.queue.Len() > 0 {
+		c.removeEntry(c.queue[0])
+	}
+}
+
+// 移除所有已过期的记录，返回移除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	expired := make([]*entry, 0)
+	for _, e := range c.queue {
+		if e.expired(now) {
+			expired = append(expired, e)
+		}
+	}
+	for _, e := range expired {
+		c.removeEntry(e)
+	}
+	return len(expired)
+}
+
+func (c *Cache) removeEntry(e *entry) {
+	heap.Remove(&c.queue, e.index)
+	delete(c.cache, e.key)
+	c.nbytes -= int64(len(e.key)) + int64(e.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// 新增/修改缓存，永不过期
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 新增/修改缓存，并设置过期时间；ttl <= 0 表示永不过期
+// 修改已存在的记录也算作一次访问
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+
+	if e, ok := c.cache[key]; ok {
+		c.nbytes += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
+		e.expire = expire
+		c.touch(e)
+	} else {
+		c.clock++
+		e := &entry{key: key, value: value, expire: expire, freq: 1, tick: c.clock}
+		heap.Push(&c.queue, e)
+		c.cache[key] = e
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+
+	// 超过了缓存允许使用的最大值，则开始淘汰缓存
+	for c.maxBytes != 0 && c.nbytes > c.maxBytes {
+		c.RemoveLeastFrequent()
+	}
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return c.queue.Len()
+}
+
+// 当前已使用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// entryHeap 实现了 heap.Interface 接口
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].tick < h[j].tick
+}
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
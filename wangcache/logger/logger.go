@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+//可替换的结构化日志接口
+//热点路径 (Map.Get、PickPeer、Group.Get、ServeHTTP) 上的日志都是 Debug 级别，默认的 Nop 不输出任何日志，
+//需要时通过 Group、HTTPPool、consistenthash.Map 各自的配置项注入
+//args 为交替出现的键值对，如 logger.Debug("cache hit", "group", "scores", "key", "Tom")，与 log/slog 的约定相同
+
+// 日志级别，数值与 slog.Level 相同
+type Level int
+
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// 组件实现了 Setter 时，可以在创建之后注入 Logger，比如 HTTPPool 会把自己的 Logger 传给放置算法
+type Setter interface {
+	SetLogger(l Logger)
+}
+
+// *slog.Logger 本身就实现了 Logger
+var _ Logger = (*slog.Logger)(nil)
+
+// 不输出任何日志，是所有组件的默认值
+var Nop Logger = nop{}
+
+type nop struct{}
+
+func (nop) Debug(msg string, args ...interface{}) {}
+func (nop) Info(msg string, args ...interface{})  {}
+func (nop) Warn(msg string, args ...interface{})  {}
+func (nop) Error(msg string, args ...interface{}) {}
+
+// 使用 log/slog 输出日志，级别和格式由 slog 的 Handler 决定；l 为 nil 时使用 slog.Default()
+func Slog(l *slog.Logger) Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
+
+// 使用标准库的 log.Logger 输出日志，只输出不低于 level 的日志，格式如:
+//
+//	INFO peer recovered peer=http://localhost:8002 successes=2
+//
+// l 为 nil 时使用 log.Default()
+func Std(l *log.Logger, level Level) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &std{l: l, level: level}
+}
+
+type std struct {
+	l     *log.Logger
+	level Level
+}
+
+func (s *std) Debug(msg string, args ...interface{}) { s.log(LevelDebug, msg, args) }
+func (s *std) Info(msg string, args ...interface{})  { s.log(LevelInfo, msg, args) }
+func (s *std) Warn(msg string, args ...interface{})  { s.log(LevelWarn, msg, args) }
+func (s *std) Error(msg string, args ...interface{}) { s.log(LevelError, msg, args) }
+
+func (s *std) log(level Level, msg string, args []interface{}) {
+	if level < s.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		// 落单的最后一个参数没有对应的键
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+			break
+		}
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	s.l.Output(3, b.String())
+}
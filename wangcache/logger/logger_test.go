@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestStd(t *testing.T) {
+	var buf bytes.Buffer
+	l := Std(log.New(&buf, "", 0), LevelInfo)
+
+	l.Debug("cache hit", "key", "Tom")
+	l.Info("peer ejected", "peer", "http://localhost:8002", "failures", 3)
+	l.Error("odd", "key")
+
+	expect := "INFO peer ejected peer=http://localhost:8002 failures=3\n" +
+		"ERROR odd !BADKEY=key\n"
+	if buf.String() != expect {
+		t.Fatalf("expect %q, but got %q", expect, buf.String())
+	}
+}
+
+func TestSlog(t *testing.T) {
+	var buf bytes.Buffer
+	l := Slog(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	l.Debug("cache hit", "group", "scores", "key", "Tom")
+
+	if out := buf.String(); !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "group=scores key=Tom") {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	if LevelWarn.String() != "WARN" || Level(slog.LevelError) != LevelError {
+		t.Fatalf("levels should match slog")
+	}
+}
@@ -1,6 +1,10 @@
 package lru
 
-import "container/list"
+import (
+	"7go/wangCache/wangcache/policy"
+	"container/list"
+	"time"
+)
 
 // Cache is a LRU cache. It is not safe for concurrent access.
 // 使用 lru 缓存淘汰策略
@@ -18,13 +22,20 @@ type Cache struct {
 type entry struct {
 	key string
 	value Value  // 为了通用性，我们允许值是实现了 Value 接口的任意类型; 即只要实现了Value接口就可以作为缓存值
+	expire time.Time  // 过期时间，零值表示永不过期
 }
 
-// Value use Len() to count how many bytes it takes
-type Value interface {
-	Len() int  // 用于返回值所占用的内存大小
+// 判断记录在 now 时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
 }
 
+// Value use Len() to count how many bytes it takes
+// 与 policy.Value 是同一个类型，这样 *Cache 才能实现 policy.Cache 接口
+type Value = policy.Value
+
+var _ policy.Cache = (*Cache)(nil)
+
 func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 	return &Cache{
 		maxBytes:  maxBytes,
@@ -35,12 +46,17 @@ func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 }
 
 // 获取缓存
+// 采用惰性过期：访问到已过期的记录时，直接将其移除并当作未命中处理
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	ele, ok := c.cache[key]
 	if ok {
+		kv := ele.Value.(*entry)
+		if kv.expired(time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
 		// 将当前元素移动到链表最前面 (删除元素的时候是从链表最后面开始移除的)
 		c.ll.MoveToFront(ele)
-		kv := ele.Value.(*entry)
 		return kv.value, ok
 	}
 	return
@@ -51,18 +67,62 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value)
+		c.removeElement(ele)
+	}
+}
+
+// 移除指定的缓存
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// 清空所有缓存，每条记录都会触发回调函数
+func (c *Cache) Purge() {
+	for ele := c.ll.Back(); ele != nil; ele = c.ll.Back() {
+		c.removeElement(ele)
+	}
+}
+
+// 移除所有已过期的记录，返回移除的数量 (供后台定时清理使用)
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+			n++
 		}
+		ele = prev
+	}
+	return n
+}
+
+// 从链表和map中删除指定节点，并触发回调函数
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
 	}
 }
 
-// 新增/修改缓存
+// 新增/修改缓存，永不过期
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 新增/修改缓存，并设置过期时间；ttl <= 0 表示永不过期
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+
 	ele, ok := c.cache[key]
 	// 存在则更新值
 	if ok {
@@ -70,10 +130,11 @@ func (c *Cache) Add(key string, value Value) {
 		kv := ele.Value.(*entry)
 		// 重新计算所占字节数
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
-		// 更新值
+		// 更新值和过期时间
 		kv.value = value
+		kv.expire = expire
 	} else {
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry{key, value, expire})
 		c.cache[key] = ele
 		c.nbytes += int64(len(key)) + int64(value.Len())
 	}
@@ -89,6 +150,11 @@ func (c *Cache) Len() int {
 	return c.ll.Len()
 }
 
+// 当前已使用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
 
 
 
@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -65,12 +66,73 @@ func TestOnEvicted(t *testing.T) {
 	}
 }
 
+//测试过期的记录在访问时会被惰性移除
+func TestTTL(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.AddWithTTL("key1", String("123"), 10*time.Millisecond)
+	lru.Add("key2", String("456"))
 
+	if _, ok := lru.Get("key1"); !ok {
+		t.Fatalf("cache hit key1 before expire failed!")
+	}
 
+	time.Sleep(20 * time.Millisecond)
 
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatalf("key1 should be expired, len = %d", lru.Len())
+	}
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatalf("key2 without ttl should never expire")
+	}
+}
 
+//测试 RemoveExpired 能否清理掉所有过期记录并触发回调
+func TestRemoveExpired(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
 
+	lru := New(int64(0), callback)
+	lru.AddWithTTL("k1", String("v1"), 10*time.Millisecond)
+	lru.Add("k2", String("v2"))
+	lru.AddWithTTL("k3", String("v3"), 10*time.Millisecond)
+	lru.AddWithTTL("k4", String("v4"), time.Hour)
 
+	time.Sleep(20 * time.Millisecond)
 
+	if n := lru.RemoveExpired(); n != 2 || lru.Len() != 2 {
+		t.Fatalf("expect 2 expired entries removed, but got %d, len = %d", n, lru.Len())
+	}
 
+	expect := []string{"k1", "k3"}
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, but got keys is %s", expect, keys)
+	}
+}
+
+//测试移除指定缓存和清空缓存
+func TestRemoveAndPurge(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
 
+	lru := New(int64(0), callback)
+	lru.Add("k1", String("v1"))
+	lru.Add("k2", String("v2"))
+	lru.Add("k3", String("v3"))
+
+	lru.Remove("k2")
+	if _, ok := lru.Get("k2"); ok || lru.Len() != 2 {
+		t.Fatalf("Remove key[k2] failed!")
+	}
+
+	lru.Purge()
+	if _, ok := lru.Get("k1"); ok || lru.Len() != 0 {
+		t.Fatalf("Purge failed!")
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expect OnEvicted to be called 3 times, but got %d", len(keys))
+	}
+}
@@ -0,0 +1,579 @@
+package membership
+
+import (
+	"7go/wangCache/wangcache/logger"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//基于 SWIM 协议的集群成员管理 (节点发现与故障检测)
+
+//每个节点定期随机选择一个节点发送 ping，超时未收到 ack 时，请求另外 k 个节点代为探测 (ping-req)，
+//仍然失败则将该节点标记为 suspect。被怀疑的节点收到消息后，增加自己的 incarnation 进行反驳；
+//超过 suspectTimeout 没有反驳的节点被认为已经宕机。
+//间接探测可以避免因为两个节点之间的网络问题而误判。
+//成员的变化捎带在探测消息中传播，并定期与随机节点全量同步，每个节点只需要知道一个种子节点即可加入集群。
+
+// 节点的加入和离开会同步到哈希环上，*wangcache.HTTPPool 实现了该接口
+type Ring interface {
+	AddPeers(peers ...string)
+	RemovePeers(peers ...string)
+}
+
+const (
+	defaultProbeInterval  = time.Second
+	defaultProbeTimeout   = 200 * time.Millisecond
+	defaultSuspectTimeout = 5 * time.Second
+	defaultIndirectChecks = 3
+
+	// 每隔多少个探测周期与一个随机的节点全量同步一次状态
+	// 捎带传播的变化只会被发送有限次，全量同步保证错过这些消息的节点最终也能得到一致的视图
+	pushPullPeriods = 10
+
+	// 读取消息持续失败时，重试前等待的最长时间
+	maxReadBackoff = time.Second
+)
+
+// 集群中的一个节点
+type Member struct {
+	Name        string // 节点名称，同时也是哈希环上的节点，一般是节点的 HTTP 地址，如 http://localhost:8001
+	Addr        string // gossip 使用的 UDP 地址
+	State       State
+	Incarnation uint64
+}
+
+// 节点是否在哈希环上，suspect 状态的节点仍然可以处理请求
+func (m Member) up() bool {
+	return m.State == StateAlive || m.State == StateSuspect
+}
+
+type member struct {
+	Member
+	suspectAt time.Time // 被标记为 suspect 的时间
+}
+
+func (m *member) update() update {
+	return update{Name: m.Name, Addr: m.Addr, State: m.State, Incarnation: m.Incarnation}
+}
+
+type Memberlist struct {
+	self           string
+	conn           net.PacketConn
+	probeInterval  time.Duration
+	probeTimeout   time.Duration
+	suspectTimeout time.Duration
+	indirectChecks int
+	ring           Ring
+	logger         logger.Logger
+
+	mu         sync.Mutex
+	members    map[string]*member // 所有已知的节点，包括自己和已经宕机的节点
+	queue      []*broadcast       // 等待捎带发送的成员变化
+	probeOrder []string           // 探测的顺序，每轮随机打乱
+	probeIndex int
+	leaving    bool
+
+	seq  uint64                   // 探测消息的序号
+	acks map[uint64]chan struct{} // 正在等待 ack 的探测
+
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	drop func(addr string) bool // 测试用：返回 true 时不向 addr 发送消息
+}
+
+type Option func(*Memberlist)
+
+// WithProbeInterval 设置探测的间隔以及等待 ack 的超时时间，timeout 需要小于 interval
+func WithProbeInterval(interval, timeout time.Duration) Option {
+	return func(m *Memberlist) {
+		m.probeInterval = interval
+		m.probeTimeout = timeout
+	}
+}
+
+// WithSuspectTimeout 设置 suspect 状态的节点多久没有反驳后被认为已经宕机
+func WithSuspectTimeout(timeout time.Duration) Option {
+	return func(m *Memberlist) {
+		m.suspectTimeout = timeout
+	}
+}
+
+// WithIndirectChecks 设置直接探测失败后，请求多少个节点代为探测
+func WithIndirectChecks(k int) Option {
+	return func(m *Memberlist) {
+		m.indirectChecks = k
+	}
+}
+
+// WithRing 将节点的加入和离开同步到哈希环上
+func WithRing(ring Ring) Option {
+	return func(m *Memberlist) {
+		m.ring = ring
+	}
+}
+
+// WithLogger 设置输出日志的 Logger，默认不输出任何日志
+// 节点的加入、离开等状态变化为 Info 级别，收发消息失败为 Warn 级别
+func WithLogger(l logger.Logger) Option {
+	return func(m *Memberlist) {
+		m.logger = l
+	}
+}
+
+// 创建节点并监听 addr (UDP)，name 为节点在集群中的名称
+// addr 的端口为0时会随机选择一个端口，通过 Addr 获取实际的地址
+func New(name, addr string, opts ...Option) (*Memberlist, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Memberlist{
+		self:           name,
+		conn:           conn,
+		probeInterval:  defaultProbeInterval,
+		probeTimeout:   defaultProbeTimeout,
+		suspectTimeout: defaultSuspectTimeout,
+		indirectChecks: defaultIndirectChecks,
+		logger:         logger.Nop,
+		members:        make(map[string]*member),
+		acks:           make(map[uint64]chan struct{}),
+		stop:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	self := &member{Member: Member{Name: name, Addr: conn.LocalAddr().String(), State: StateAlive}}
+	m.members[name] = self
+	// 通过探测消息把自己广播出去
+	m.enqueue(self.update())
+	if m.ring != nil {
+		m.ring.AddPeers(name)
+	}
+
+	m.wg.Add(2)
+	go m.receive()
+	go m.probeLoop()
+	return m, nil
+}
+
+// 返回 gossip 实际监听的 UDP 地址
+func (m *Memberlist) Addr() string {
+	return m.conn.LocalAddr().String()
+}
+
+// 通过种子节点加入集群，返回成功响应的种子节点数量
+func (m *Memberlist) Join(seeds ...string) (int, error) {
+	var joined int32
+	var wg sync.WaitGroup
+	for _, seed := range seeds {
+		wg.Add(1)
+		go func(seed string) {
+			defer wg.Done()
+			seq, ack := m.expectAck()
+			defer m.forgetAck(seq)
+
+			if err := m.send(seed, &message{Type: pushPullMsg, Seq: seq, Updates: m.state()}); err != nil {
+				m.logger.Warn("join failed", "self", m.self, "seed", seed, "error", err)
+				return
+			}
+			select {
+			case <-ack:
+				atomic.AddInt32(&joined, 1)
+			case <-time.After(m.probeInterval):
+				m.logger.Warn("join timeout", "self", m.self, "seed", seed)
+			}
+		}(seed)
+	}
+	wg.Wait()
+
+	if joined == 0 && len(seeds) > 0 {
+		return 0, fmt.Errorf("membership: failed to join any of %v", seeds)
+	}
+	return int(joined), nil
+}
+
+// 通知集群中的其他节点自己将要离开，之后应调用 Close
+func (m *Memberlist) Leave() error {
+	m.mu.Lock()
+	m.leaving = true
+	self := m.members[m.self]
+	self.State = StateLeft
+	self.Incarnation++
+	u := self.update()
+
+	addrs := make([]string, 0, len(m.members))
+	for _, mem := range m.members {
+		if mem.Name != m.self && mem.up() {
+			addrs = append(addrs, mem.Addr)
+		}
+	}
+	m.mu.Unlock()
+
+	// 直接通知所有节点，不等待通过探测消息传播
+	var err error
+	for _, addr := range addrs {
+		if e := m.send(addr, &message{Type: syncMsg, Updates: []update{u}}); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// 停止探测并关闭连接
+func (m *Memberlist) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		err = m.conn.Close()
+		m.wg.Wait()
+	})
+	return err
+}
+
+// 返回所有在线的节点 (包括自己)，按名称排序
+func (m *Memberlist) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members := make([]Member, 0, len(m.members))
+	for _, mem := range m.members {
+		if mem.up() {
+			members = append(members, mem.Member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+	return members
+}
+
+//**********************************
+// 收发消息
+//**********************************
+
+func (m *Memberlist) send(addr string, msg *message) error {
+	m.mu.Lock()
+	if m.drop != nil && m.drop(addr) {
+		m.mu.Unlock()
+		return nil
+	}
+	if msg.Updates == nil {
+		msg.Updates = m.piggyback()
+	}
+	m.mu.Unlock()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	to, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	_, err = m.conn.WriteTo(data, to)
+	return err
+}
+
+func (m *Memberlist) receive() {
+	defer m.wg.Done()
+
+	buf := make([]byte, 65536)
+	var backoff time.Duration
+	for {
+		n, from, err := m.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// 持续出现的错误每次都会立即返回，逐渐增加重试前的等待时间，避免空转
+			switch {
+			case backoff == 0:
+				backoff = 5 * time.Millisecond
+			case backoff < maxReadBackoff:
+				backoff *= 2
+			}
+			m.logger.Warn("read failed", "self", m.self, "error", err, "backoff", backoff)
+			select {
+			case <-m.stop:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		msg := new(message)
+		if err := json.Unmarshal(buf[:n], msg); err != nil {
+			m.logger.Warn("bad message", "self", m.self, "from", from, "error", err)
+			continue
+		}
+		m.handle(from.String(), msg)
+	}
+}
+
+func (m *Memberlist) handle(from string, msg *message) {
+	m.mu.Lock()
+	for _, u := range msg.Updates {
+		m.apply(u)
+	}
+	m.mu.Unlock()
+
+	switch msg.Type {
+	case pingMsg:
+		m.send(from, &message{Type: ackMsg, Seq: msg.Seq})
+	case pingReqMsg:
+		m.wg.Add(1)
+		go m.indirectPing(from, msg)
+	case ackMsg, syncMsg:
+		m.notifyAck(msg.Seq)
+	case pushPullMsg:
+		m.send(from, &message{Type: syncMsg, Seq: msg.Seq, Updates: m.state()})
+	}
+}
+
+// 代替 requester 探测 Target，收到 ack 后转发给 requester
+func (m *Memberlist) indirectPing(requester string, req *message) {
+	defer m.wg.Done()
+
+	seq, ack := m.expectAck()
+	defer m.forgetAck(seq)
+
+	if err := m.send(req.Target, &message{Type: pingMsg, Seq: seq}); err != nil {
+		return
+	}
+	select {
+	case <-ack:
+		m.send(requester, &message{Type: ackMsg, Seq: req.Seq})
+	case <-time.After(m.probeTimeout):
+	case <-m.stop:
+	}
+}
+
+// 返回所有已知节点的状态
+func (m *Memberlist) state() []update {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	updates := make([]update, 0, len(m.members))
+	for _, mem := range m.members {
+		updates = append(updates, mem.update())
+	}
+	return updates
+}
+
+func (m *Memberlist) expectAck() (uint64, chan struct{}) {
+	seq := atomic.AddUint64(&m.seq, 1)
+	ack := make(chan struct{}, 1)
+
+	m.mu.Lock()
+	m.acks[seq] = ack
+	m.mu.Unlock()
+	return seq, ack
+}
+
+func (m *Memberlist) forgetAck(seq uint64) {
+	m.mu.Lock()
+	delete(m.acks, seq)
+	m.mu.Unlock()
+}
+
+func (m *Memberlist) notifyAck(seq uint64) {
+	m.mu.Lock()
+	ack, ok := m.acks[seq]
+	m.mu.Unlock()
+
+	if ok {
+		select {
+		case ack <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//**********************************
+// 更新节点状态
+//**********************************
+
+// 应用一个节点的状态变化，调用时需要持有 m.mu
+func (m *Memberlist) apply(u update) {
+	if u.Name == m.self {
+		self := m.members[m.self]
+		// 其他节点怀疑自己已经宕机，增加 incarnation 进行反驳
+		if u.State != StateAlive && !m.leaving && u.Incarnation >= self.Incarnation {
+			self.Incarnation = u.Incarnation + 1
+			m.enqueue(self.update())
+			m.logger.Info("refute", "self", m.self, "state", u.State, "incarnation", self.Incarnation)
+		}
+		return
+	}
+
+	cur, ok := m.members[u.Name]
+	if !ok {
+		cur = &member{Member: Member{Name: u.Name, State: StateDead}}
+		m.members[u.Name] = cur
+	} else if !u.overrides(cur.Member) {
+		return
+	}
+
+	wasUp := ok && cur.up()
+	cur.Addr = u.Addr
+	cur.State = u.State
+	cur.Incarnation = u.Incarnation
+	if u.State == StateSuspect {
+		cur.suspectAt = time.Now()
+	}
+	m.enqueue(u)
+
+	switch {
+	case !wasUp && cur.up():
+		m.logger.Info("node joined", "self", m.self, "node", u.Name)
+		if m.ring != nil {
+			m.ring.AddPeers(u.Name)
+		}
+	case wasUp && !cur.up():
+		m.logger.Info("node left", "self", m.self, "node", u.Name, "state", u.State)
+		if m.ring != nil {
+			m.ring.RemovePeers(u.Name)
+		}
+	}
+}
+
+//**********************************
+// 故障检测
+//**********************************
+
+func (m *Memberlist) probeLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.probeInterval)
+	defer ticker.Stop()
+
+	for periods := 1; ; periods++ {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.checkSuspects()
+			m.probe()
+			if periods%pushPullPeriods == 0 {
+				m.pushPull()
+			}
+		}
+	}
+}
+
+// 与一个随机的节点交换全部的状态
+func (m *Memberlist) pushPull() {
+	for _, addr := range m.randomPeers(1, "") {
+		m.send(addr, &message{Type: pushPullMsg, Updates: m.state()})
+	}
+}
+
+// 将超时没有反驳的 suspect 节点标记为 dead
+func (m *Memberlist) checkSuspects() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, mem := range m.members {
+		if mem.State == StateSuspect && time.Since(mem.suspectAt) >= m.suspectTimeout {
+			m.apply(update{Name: mem.Name, Addr: mem.Addr, State: StateDead, Incarnation: mem.Incarnation})
+		}
+	}
+}
+
+// 探测下一个节点，直接探测失败时请求其他节点间接探测
+func (m *Memberlist) probe() {
+	target, ok := m.nextTarget()
+	if !ok {
+		return
+	}
+
+	seq, ack := m.expectAck()
+	defer m.forgetAck(seq)
+
+	m.send(target.Addr, &message{Type: pingMsg, Seq: seq})
+	select {
+	case <-ack:
+		return
+	case <-time.After(m.probeTimeout):
+	case <-m.stop:
+		return
+	}
+
+	for _, addr := range m.randomPeers(m.indirectChecks, target.Name) {
+		m.send(addr, &message{Type: pingReqMsg, Seq: seq, Target: target.Addr})
+	}
+	// 间接探测的时间为一个探测周期剩余的时间
+	select {
+	case <-ack:
+		return
+	case <-time.After(m.probeInterval - m.probeTimeout):
+	case <-m.stop:
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur := m.members[target.Name]; cur.State == StateAlive && cur.Incarnation == target.Incarnation {
+		m.apply(update{Name: cur.Name, Addr: cur.Addr, State: StateSuspect, Incarnation: cur.Incarnation})
+	}
+}
+
+// 按随机的顺序轮流探测每一个在线的节点，每轮结束后重新打乱顺序
+func (m *Memberlist) nextTarget() (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for attempts := 0; attempts < 2; attempts++ {
+		for ; m.probeIndex < len(m.probeOrder); m.probeIndex++ {
+			if mem, ok := m.members[m.probeOrder[m.probeIndex]]; ok && mem.up() {
+				m.probeIndex++
+				return mem.Member, true
+			}
+		}
+
+		m.probeOrder = m.probeOrder[:0]
+		for name, mem := range m.members {
+			if name != m.self && mem.up() {
+				m.probeOrder = append(m.probeOrder, name)
+			}
+		}
+		rand.Shuffle(len(m.probeOrder), func(i, j int) {
+			m.probeOrder[i], m.probeOrder[j] = m.probeOrder[j], m.probeOrder[i]
+		})
+		m.probeIndex = 0
+	}
+	return Member{}, false
+}
+
+// 随机选择最多 k 个在线的节点，不包括自己和 exclude
+func (m *Memberlist) randomPeers(k int, exclude string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	addrs := make([]string, 0, len(m.members))
+	for name, mem := range m.members {
+		if name != m.self && name != exclude && mem.up() {
+			addrs = append(addrs, mem.Addr)
+		}
+	}
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	if len(addrs) > k {
+		addrs = addrs[:k]
+	}
+	return addrs
+}
@@ -0,0 +1,209 @@
+package membership
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 记录同步到哈希环上的节点
+type fakeRing struct {
+	mu    sync.Mutex
+	peers map[string]bool
+}
+
+func (r *fakeRing) AddPeers(peers ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, peer := range peers {
+		r.peers[peer] = true
+	}
+}
+
+func (r *fakeRing) RemovePeers(peers ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, peer := range peers {
+		delete(r.peers, peer)
+	}
+}
+
+func (r *fakeRing) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	peers := make([]string, 0, len(r.peers))
+	for peer := range r.peers {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// 在本地回环地址上启动 n 个节点，之后的节点都通过第一个节点加入集群
+func newTestCluster(t *testing.T, n int) ([]*Memberlist, []*fakeRing) {
+	nodes := make([]*Memberlist, n)
+	rings := make([]*fakeRing, n)
+	for i := range nodes {
+		rings[i] = &fakeRing{peers: make(map[string]bool)}
+		m, err := New(fmt.Sprintf("node%d", i), "127.0.0.1:0",
+			WithProbeInterval(20*time.Millisecond, 5*time.Millisecond),
+			WithSuspectTimeout(60*time.Millisecond),
+			WithRing(rings[i]))
+		if err != nil {
+			t.Fatalf("failed to start node%d: %v", i, err)
+		}
+		t.Cleanup(func() { m.Close() })
+		nodes[i] = m
+	}
+	for _, m := range nodes[1:] {
+		if _, err := m.Join(nodes[0].Addr()); err != nil {
+			t.Fatalf("%s failed to join: %v", m.self, err)
+		}
+	}
+	return nodes, rings
+}
+
+// 等待所有哈希环上的节点都变为 expect
+func waitRings(t *testing.T, rings []*fakeRing, expect []string) {
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		done := true
+		for _, r := range rings {
+			if !reflect.DeepEqual(r.list(), expect) {
+				done = false
+			}
+		}
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			for i, r := range rings {
+				t.Logf("ring %d: %v", i, r.list())
+			}
+			t.Fatalf("rings did not converge to %v", expect)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	nodes, rings := newTestCluster(t, 5)
+	waitRings(t, rings, []string{"node0", "node1", "node2", "node3", "node4"})
+
+	members := nodes[4].Members()
+	if len(members) != 5 || members[0].Name != "node0" || members[0].Addr != nodes[0].Addr() {
+		t.Fatalf("unexpected members %v", members)
+	}
+
+}
+
+func TestFailureDetection(t *testing.T) {
+	nodes, rings := newTestCluster(t, 4)
+	waitRings(t, rings, []string{"node0", "node1", "node2", "node3"})
+
+	// 节点宕机 (没有通知其他节点)，经过 suspect 超时后被移出哈希环
+	nodes[3].Close()
+	waitRings(t, rings[:3], []string{"node0", "node1", "node2"})
+	for _, mem := range nodes[0].Members() {
+		if mem.Name == "node3" {
+			t.Fatalf("expect node3 to be removed from members")
+		}
+	}
+}
+
+func TestLeave(t *testing.T) {
+	nodes, rings := newTestCluster(t, 3)
+	waitRings(t, rings, []string{"node0", "node1", "node2"})
+
+	if err := nodes[2].Leave(); err != nil {
+		t.Fatalf("failed to leave: %v", err)
+	}
+	waitRings(t, rings[:2], []string{"node0", "node1"})
+}
+
+func TestIndirectPing(t *testing.T) {
+	nodes, rings := newTestCluster(t, 3)
+	waitRings(t, rings, []string{"node0", "node1", "node2"})
+
+	// node0 与 node1 之间的网络不通，但它们都可以通过 node2 间接探测到对方
+	block := func(addr string) func(string) bool {
+		return func(to string) bool { return to == addr }
+	}
+	nodes[0].mu.Lock()
+	nodes[0].drop = block(nodes[1].Addr())
+	nodes[0].mu.Unlock()
+	nodes[1].mu.Lock()
+	nodes[1].drop = block(nodes[0].Addr())
+	nodes[1].mu.Unlock()
+
+	// 等待足够多的探测周期，期间任何节点都不能被怀疑 (被怀疑的节点反驳时会增加 incarnation)
+	time.Sleep(500 * time.Millisecond)
+	for i, r := range rings {
+		if got := r.list(); len(got) != 3 {
+			t.Fatalf("ring %d: expect all nodes alive, but got %v", i, got)
+		}
+	}
+	for _, mem := range nodes[2].Members() {
+		if mem.State != StateAlive || mem.Incarnation != 0 {
+			t.Fatalf("expect %s to be never suspected, but got %s with incarnation %d", mem.Name, mem.State, mem.Incarnation)
+		}
+	}
+}
+
+// 读取时总是返回同一个错误的连接
+type errConn struct {
+	net.PacketConn
+	reads int32
+}
+
+func (c *errConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	atomic.AddInt32(&c.reads, 1)
+	return 0, nil, errors.New("bad conn")
+}
+
+// 记录日志的消息和参数
+type recordLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *recordLogger) log(msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprint(append([]interface{}{msg}, args...)...))
+}
+
+func (l *recordLogger) Debug(msg string, args ...interface{}) { l.log(msg, args...) }
+func (l *recordLogger) Info(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordLogger) Warn(msg string, args ...interface{})  { l.log(msg, args...) }
+func (l *recordLogger) Error(msg string, args ...interface{}) { l.log(msg, args...) }
+
+func TestReadBackoff(t *testing.T) {
+	conn := &errConn{}
+	logs := &recordLogger{}
+	m := &Memberlist{self: "node0", conn: conn, stop: make(chan struct{})}
+	WithLogger(logs)(m)
+
+	// 读取一直失败时逐渐增加等待时间，而不是不停地重试
+	m.wg.Add(1)
+	go m.receive()
+	time.Sleep(200 * time.Millisecond)
+	close(m.stop)
+	m.wg.Wait()
+
+	if reads := atomic.LoadInt32(&conn.reads); reads < 2 || reads > 10 {
+		t.Fatalf("expect read to back off, but got %d reads", reads)
+	}
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	if len(logs.logs) == 0 || !strings.Contains(logs.logs[0], "read failed") || !strings.Contains(logs.logs[0], "node0") {
+		t.Fatalf("unexpected logs %v", logs.logs)
+	}
+}
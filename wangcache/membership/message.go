@@ -0,0 +1,123 @@
+package membership
+
+import (
+	"math"
+	"sort"
+)
+
+// 节点的状态
+type State int
+
+const (
+	StateAlive   State = iota // 正常
+	StateSuspect              // 探测失败，等待节点自己反驳，超时后被认为已经宕机
+	StateDead                 // 已经宕机
+	StateLeft                 // 主动离开集群
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	}
+	return "unknown"
+}
+
+// 消息类型
+type msgType uint8
+
+const (
+	pingMsg     msgType = iota // 直接探测，对方回复 ack
+	pingReqMsg                 // 请求对方代为探测 Target，收到 Target 的 ack 后转发给发送方
+	ackMsg                     // 探测的响应，Seq 与探测消息相同
+	pushPullMsg                // 包含发送方知道的所有节点的状态，对方合并后回复 sync (加入集群以及定期的全量同步)
+	syncMsg                    // 包含发送方知道的所有节点的状态
+)
+
+// 节点之间传递的消息，使用 JSON 编码后通过 UDP 发送
+// 每条消息都会捎带 (piggyback) 最近的成员变化，通过探测消息把变化传播到整个集群，不需要单独的广播
+type message struct {
+	Type    msgType  `json:"type"`
+	Seq     uint64   `json:"seq,omitempty"`
+	Target  string   `json:"target,omitempty"`
+	Updates []update `json:"updates,omitempty"`
+}
+
+// 某个节点的状态变化
+type update struct {
+	Name        string `json:"name"`
+	Addr        string `json:"addr"`
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"inc"`
+}
+
+// 判断 u 是否比 cur 更新：
+// incarnation 只能由节点自己增加 (用来反驳其他节点对它的怀疑)，所以更大的 incarnation 总是更新的；
+// 相同的 incarnation 下，dead/left 优先于 suspect，suspect 优先于 alive
+func (u update) overrides(cur Member) bool {
+	if u.Incarnation != cur.Incarnation {
+		return u.Incarnation > cur.Incarnation
+	}
+	return u.State > cur.State
+}
+
+// 等待广播的成员变化
+type broadcast struct {
+	update    update
+	transmits int // 已经捎带发送的次数
+}
+
+// 每条消息最多捎带的成员变化数量，避免 UDP 包过大
+const maxPiggyback = 8
+
+// 每个变化被发送 retransmitMult * log10(n+1) 次后不再发送，n 为集群节点数
+const retransmitMult = 4
+
+// 加入一个等待广播的变化，同一个节点之前的变化会被替换，调用时需要持有 m.mu
+func (m *Memberlist) enqueue(u update) {
+	for i, b := range m.queue {
+		if b.update.Name == u.Name {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			break
+		}
+	}
+	m.queue = append(m.queue, &broadcast{update: u})
+}
+
+// 取出需要捎带的变化，优先发送次数少的，调用时需要持有 m.mu
+func (m *Memberlist) piggyback() []update {
+	if len(m.queue) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(m.queue, func(i, j int) bool {
+		return m.queue[i].transmits < m.queue[j].transmits
+	})
+	limit := retransmitMult * int(math.Ceil(math.Log10(float64(len(m.members)+1))))
+
+	n := len(m.queue)
+	if n > maxPiggyback {
+		n = maxPiggyback
+	}
+	updates := make([]update, 0, n)
+	for _, b := range m.queue[:n] {
+		updates = append(updates, b.update)
+		b.transmits++
+	}
+
+	// 移除已经发送足够次数的变化
+	queue := m.queue[:0]
+	for _, b := range m.queue {
+		if b.transmits < limit {
+			queue = append(queue, b)
+		}
+	}
+	m.queue = queue
+	return updates
+}
@@ -0,0 +1,66 @@
+package wangcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+//以 Prometheus 文本格式导出所有group的统计数据，每个group通过 group 标签区分，如:
+//  wangcache_gets_total{group="scores"} 42
+//Prometheus 抓取 /<basepath>/_metrics 即可，不依赖 Prometheus 的客户端库
+
+// 导出的指标，value 从 Stats 中取出对应的字段
+var metrics = []struct {
+	name  string
+	kind  string // counter 或 gauge
+	help  string
+	value func(s Stats) int64
+}{
+	{"wangcache_gets_total", "counter", "Number of get requests.", func(s Stats) int64 { return s.Gets }},
+	{"wangcache_hits_total", "counter", "Number of requests answered from cache without loading.", func(s Stats) int64 { return s.Hits }},
+	{"wangcache_misses_total", "counter", "Number of requests that missed the cache.", func(s Stats) int64 { return s.Misses }},
+	{"wangcache_peer_loads_total", "counter", "Number of successful loads from remote peers.", func(s Stats) int64 { return s.PeerLoads }},
+	{"wangcache_peer_errors_total", "counter", "Number of failed requests to remote peers.", func(s Stats) int64 { return s.PeerErrors }},
+	{"wangcache_local_loads_total", "counter", "Number of loads from the local getter.", func(s Stats) int64 { return s.LocalLoads }},
+	{"wangcache_dedups_total", "counter", "Number of requests that shared another in-flight load.", func(s Stats) int64 { return s.Dedups }},
+	{"wangcache_evictions_total", "counter", "Number of entries evicted for capacity or expiration.", func(s Stats) int64 { return s.Evictions }},
+	{"wangcache_bytes", "gauge", "Bytes used by cached entries.", func(s Stats) int64 { return s.Bytes }},
+	{"wangcache_items", "gauge", "Number of cached entries.", func(s Stats) int64 { return s.Items }},
+}
+
+// 按 Prometheus 文本格式写出所有group的统计数据，同一个指标的所有group写在一起
+func writeMetrics(w io.Writer, groups []*Group) error {
+	stats := make([]Stats, len(groups))
+	for i, g := range groups {
+		stats[i] = g.Stats()
+	}
+
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind); err != nil {
+			return err
+		}
+		for i, g := range groups {
+			if _, err := fmt.Fprintf(w, "%s{group=\"%s\"} %d\n", m.name, escapeLabel(g.name), m.value(stats[i])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 标签值中的反斜杠、双引号和换行需要转义
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// 导出 Registry 中所有group的统计数据
+func (p *HTTPPool) serveMetrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := writeMetrics(w, p.registry.Groups()); err != nil {
+		p.logger.Warn("failed to write metrics", "self", p.self, "error", err)
+	}
+}
@@ -0,0 +1,162 @@
+package wangcache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+//写操作：更新或删除缓存值
+//写操作会被路由到负责该key的节点 (由一致性哈希选择)，在该节点的 mainCache 中生效；
+//其他节点的 hotCache 中可能还保存着旧值的副本，开启广播后会通知所有节点丢弃这些副本。
+
+// Set 设置key对应的缓存值，通常在数据源中的数据被修改后调用，过期时间由 WithTTL 决定
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL 设置key对应的缓存值，经过 ttl 后过期，ttl <= 0 时与 Set 相同
+// 开启多副本时，某个节点写入失败不影响其他节点，返回的错误包含所有失败的节点；
+// 写入失败的节点上的旧值会被删除，之后访问时重新加载，而不是继续返回旧值
+func (g *Group) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	// 开启多副本时写入所有负责该key的节点
+	var errs []error
+	peers, self := g.pickOwners(key)
+	for _, peer := range peers {
+		if err := g.setPeer(peer, key, value, ttl); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set key [%s] on peer %s: %w", key, peerName(peer), err))
+			g.discard(peer, key)
+		}
+	}
+
+	if self >= 0 {
+		g.setLocally(key, ByteView{b: cloneBytes(value), e: g.expireAfter(ttl)})
+	} else {
+		g.hotCache.remove(key)
+	}
+	g.broadcastInvalidation(key)
+	return errors.Join(errs...)
+}
+
+// Remove 删除key对应的缓存值，下次访问时会重新从数据源加载
+// 与 SetWithTTL 一样会尝试所有负责该key的节点，返回的错误包含所有失败的节点
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	// 开启多副本时从所有负责该key的节点上删除
+	var errs []error
+	peers, self := g.pickOwners(key)
+	for _, peer := range peers {
+		if err := g.removePeer(peer, key); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove key [%s] from peer %s: %w", key, peerName(peer), err))
+		}
+	}
+
+	if self >= 0 {
+		g.removeLocally(key)
+	} else {
+		g.hotCache.remove(key)
+	}
+	g.broadcastInvalidation(key)
+	return errors.Join(errs...)
+}
+
+// Purge 清空当前节点上该group的所有缓存 (不影响其他节点)
+func (g *Group) Purge() {
+	g.mainCache.purge()
+	g.hotCache.purge()
+	g.negCache.purge()
+}
+
+// SetLocal 只在当前节点上设置缓存值，不再路由到其他节点，ttl <= 0 时使用 group 的过期时间
+// 用于处理其他节点转发过来的写请求 (HTTPPool 之外的 PeerPicker，如 grpcpool)
+func (g *Group) SetLocal(key string, value []byte, ttl time.Duration) {
+	g.setLocally(key, ByteView{b: cloneBytes(value), e: g.expireAfter(ttl)})
+}
+
+// RemoveLocal 只在当前节点上删除缓存值，不再路由到其他节点，用途同 SetLocal
+func (g *Group) RemoveLocal(key string) {
+	g.removeLocally(key)
+}
+
+// Invalidate 丢弃当前节点 hotCache 中该key的副本，用于处理其他节点广播的缓存失效
+func (g *Group) Invalidate(key string) {
+	g.hotCache.remove(key)
+}
+
+// 在远程节点上设置缓存值，指定了 ttl 时要求节点支持 PeerTTLSetter，否则过期时间会被忽略
+func (g *Group) setPeer(peer PeerGetter, key string, value []byte, ttl time.Duration) error {
+	if ttl > 0 {
+		setter, ok := peer.(PeerTTLSetter)
+		if !ok {
+			return fmt.Errorf("peer of key [%s] does not support set with ttl", key)
+		}
+		return setter.SetWithTTL(g.name, key, value, ttl)
+	}
+	setter, ok := peer.(PeerSetter)
+	if !ok {
+		return fmt.Errorf("peer of key [%s] does not support set", key)
+	}
+	return setter.Set(g.name, key, value)
+}
+
+// 删除远程节点上的缓存值
+func (g *Group) removePeer(peer PeerGetter, key string) error {
+	remover, ok := peer.(PeerRemover)
+	if !ok {
+		return fmt.Errorf("peer of key [%s] does not support remove", key)
+	}
+	return remover.Remove(g.name, key)
+}
+
+// 写入失败后删除节点上可能存在的旧值，删除同样失败时只记录日志，旧值最终会因为过期或淘汰而失效
+func (g *Group) discard(peer PeerGetter, key string) {
+	if err := g.removePeer(peer, key); err != nil {
+		g.logger.Warn("failed to discard stale key on peer", "group", g.name, "self", g.self(), "key", key, "peer", peerName(peer), "error", err)
+	}
+}
+
+// 在当前节点上设置缓存值，不再路由到其他节点
+func (g *Group) setLocally(key string, value ByteView) {
+	g.negCache.remove(key)
+	g.hotCache.remove(key)
+	if g.filter != nil {
+		g.filter.add(key)
+	}
+	g.populateCache(key, value)
+}
+
+// 在当前节点上删除缓存值，不再路由到其他节点
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+}
+
+// 通知其他所有节点丢弃 hotCache 中该key的副本，只有开启了广播才会执行
+// 广播失败不影响写操作本身的结果，只记录日志，副本最终会因为过期或淘汰而失效
+func (g *Group) broadcastInvalidation(key string) {
+	if !g.broadcast || g.peers == nil {
+		return
+	}
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return
+	}
+
+	for _, peer := range lister.ListPeers() {
+		invalidator, ok := peer.(PeerInvalidator)
+		if !ok {
+			continue
+		}
+		if err := invalidator.Invalidate(g.name, key); err != nil {
+			g.logger.Warn("failed to invalidate key on peer", "group", g.name, "self", g.self(), "key", key, "peer", peerName(peer), "error", err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package wangcache
+
+import (
+	"7go/wangCache/wangcache/bloom"
+	"7go/wangCache/wangcache/logger"
+	"7go/wangCache/wangcache/trace"
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Group 的可选配置项，在 NewGroup 时传入
+
+// 过期缓存的最长清理间隔
+const maxReapInterval = time.Minute
+
+type GroupOption func(*Group)
+
+// WithTTL 设置缓存值的默认过期时间
+// jitter > 0 时，每个key的实际过期时间会在 [ttl, ttl+jitter) 之间随机选取，
+// 避免同一批加载进来的key在同一时刻集中失效，引起缓存雪崩
+func WithTTL(ttl, jitter time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+		g.ttlJitter = jitter
+	}
+}
+
+// WithEvictionPolicy 设置缓存的淘汰策略，默认使用 LRU
+func WithEvictionPolicy(p EvictionPolicy) GroupOption {
+	return func(g *Group) {
+		g.policy = p
+	}
+}
+
+// WithShards 将主缓存拆分为 n 个独立加锁的分片，每个分片使用 cacheBytes/n 的内存
+// 适用于读多写少、并发很高的场景，n <= 1 表示不分片
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// WithNegativeCache 开启负缓存：Getter 返回 ErrNotFound 的key会在 ttl 时间内被记住，
+// 期间对该key的访问直接返回 ErrNotFound，不再回源查询，用于应对缓存穿透
+// cacheBytes 为负缓存最大使用的内存字节数
+func WithNegativeCache(ttl time.Duration, cacheBytes int64) GroupOption {
+	return func(g *Group) {
+		g.negTTL = ttl
+		g.negCache = cache{cacheBytes: cacheBytes}
+	}
+}
+
+// WithBloomFilter 开启布隆过滤器：缓存未命中时，先检查布隆过滤器，
+// 一定不存在的key直接返回 ErrNotFound，不再去远程节点或数据源加载
+// expectedKeys 为预计的key的数量，fpRate 为期望的误判率
+func WithBloomFilter(expectedKeys uint64, fpRate float64) GroupOption {
+	return func(g *Group) {
+		g.filter = &keyFilter{filter: bloom.New(expectedKeys, fpRate)}
+	}
+}
+
+// WithBroadcastInvalidation 开启写操作后的失效广播：
+// Set/Remove 成功后通知集群中的所有节点丢弃 hotCache 中该key的副本，避免读到旧值
+func WithBroadcastInvalidation() GroupOption {
+	return func(g *Group) {
+		g.broadcast = true
+	}
+}
+
+// WithReplication 开启多副本：每个key由哈希环上连续的 n 个节点负责 (一个主节点和 n-1 个副本节点)
+// 获取缓存值时依次尝试这些节点，主节点宕机时由副本节点提供服务，避免所有请求都落到数据源上；
+// Set/Remove 会同时作用于所有负责该key的节点
+// writeThrough 为 true 时，负责该key的节点从数据源加载到数据后，会同时写入其他副本节点
+// 需要 PeerPicker 实现 ReplicaPicker 接口
+func WithReplication(n int, writeThrough bool) GroupOption {
+	return func(g *Group) {
+		g.replicas = n
+		g.writeThrough = writeThrough
+	}
+}
+
+// WithBatchWindow 设置 BatchGetter 合并未命中key的时间窗口和每批最多的key数量
+// 第一个未命中的key到达后最多等待 window，期间其他未命中的key加入同一批，达到 size 个时立即发起调用
+// window <= 0 时不合并，即使 Getter 实现了 BatchGetter 也逐个调用 Get
+func WithBatchWindow(window time.Duration, size int) GroupOption {
+	return func(g *Group) {
+		g.batchWindow = window
+		g.batchSize = size
+	}
+}
+
+// WithTimeout 设置缓存未命中时加载的超时时间，包括访问远程节点和回源查询
+// 与调用方 ctx 的截止时间取较早的一个，超时后返回 context.DeadlineExceeded
+func WithTimeout(timeout time.Duration) GroupOption {
+	return func(g *Group) {
+		g.timeout = timeout
+	}
+}
+
+// WithLogger 设置输出日志的 Logger，默认不输出任何日志
+// 缓存命中、加载等热点路径上的日志为 Debug 级别，访问其他节点失败等为 Warn 级别
+// 每条日志都带有 group 和 self (当前节点的标识) 字段
+func WithLogger(l logger.Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+// WithTracer 设置记录 span 的 Tracer，默认不记录，span 的名称见 tracing.go
+// 即使不设置，其他节点通过请求头传递过来的链路也会继续传递给下一个节点
+func WithTracer(t trace.Tracer) GroupOption {
+	return func(g *Group) {
+		g.tracer = t
+	}
+}
+
+// 为一次加载设置超时时间，没有配置 WithTimeout 时原样返回 ctx
+func (g *Group) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, g.timeout)
+}
+
+// 计算一个新缓存值的过期时间，0 表示永不过期
+func (g *Group) expiration() time.Duration {
+	if g.ttl <= 0 {
+		return 0
+	}
+	if g.ttlJitter <= 0 {
+		return g.ttl
+	}
+	return g.ttl + time.Duration(rand.Int63n(int64(g.ttlJitter)))
+}
+
+// 计算一个新缓存值的过期时刻，零值表示永不过期
+func (g *Group) expireAt() time.Time {
+	ttl := g.expiration()
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// 计算经过 ttl 后的过期时刻，ttl <= 0 时使用 group 的过期时间
+func (g *Group) expireAfter(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return g.expireAt()
+	}
+	return time.Now().Add(ttl)
+}
+
+// 后台清理过期缓存的时间间隔
+func (g *Group) reapInterval() time.Duration {
+	if g.ttl < maxReapInterval {
+		return g.ttl
+	}
+	return maxReapInterval
+}
@@ -1,5 +1,11 @@
 package wangcache
 
+import (
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"context"
+	"time"
+)
+
 // 定义两个接口
 
 type PeerPicker interface {
@@ -9,3 +15,76 @@ type PeerPicker interface {
 type PeerGetter interface {
 	Get(group string, key string) ([]byte, error)   // 从对应 group查找缓存值
 }
+
+// 以下为可选接口
+
+// PeerGetter 实现了 PeerFetcher 时，Group 会通过它获取缓存值以及过期时间等元数据
+type PeerFetcher interface {
+	Fetch(in *pb.Request, out *pb.Response) error
+}
+
+// 以下为获取缓存值相关接口的 context 版本，节点实现了它们时 Group 优先使用，
+// 调用方取消或超时后，正在进行的远程请求随之取消
+
+type ContextPeerGetter interface {
+	GetContext(ctx context.Context, group string, key string) ([]byte, error)
+}
+
+type ContextPeerFetcher interface {
+	FetchContext(ctx context.Context, in *pb.Request, out *pb.Response) error
+}
+
+type ContextPeerBatchGetter interface {
+	GetBatchContext(ctx context.Context, group string, keys []string) ([]*pb.Response, error)
+}
+
+// 用于支持写操作以及缓存失效
+
+// PeerGetter 实现了 PeerSetter/PeerRemover 才能把写操作路由到负责该key的节点
+type PeerSetter interface {
+	Set(group string, key string, value []byte) error  // 在对应节点上设置缓存值
+}
+
+// PeerGetter 实现了 PeerTTLSetter 时，SetWithTTL 会把过期时间一起发送给对应节点
+type PeerTTLSetter interface {
+	SetWithTTL(group string, key string, value []byte, ttl time.Duration) error  // ttl <= 0 时使用对应节点上 group 的过期时间
+}
+
+type PeerRemover interface {
+	Remove(group string, key string) error  // 在对应节点上删除缓存值
+}
+
+// 通知节点丢弃其 hotCache 中保存的副本
+type PeerInvalidator interface {
+	Invalidate(group string, key string) error
+}
+
+// PeerGetter 实现了 PeerBatchGetter 时，GetMulti 会把属于同一个节点的key合并成一次请求
+type PeerBatchGetter interface {
+	// 返回的响应与 keys 一一对应，单个key的错误记录在响应的 ErrorKind 中
+	GetBatch(group string, keys []string) ([]*pb.Response, error)
+}
+
+// PeerPicker 实现了 ReplicaPicker 并且开启了多副本时，Group 会依次尝试负责该key的多个节点
+type ReplicaPicker interface {
+	// 返回负责 key 的前 n 个节点中的远程节点 (按优先级排序，第一个为主节点)，
+	// self 为当前节点在这 n 个节点中的位置，-1 表示当前节点不负责该key
+	PickReplicas(key string, n int) (peers []PeerGetter, self int)
+}
+
+// PeerPicker 实现了 OwnerPicker 时，写操作以及判断当前节点是否负责该key都使用它的结果，
+// 此时 PickPeer/PickReplicas 只用来选择读请求访问的节点 (比如按节点负载选择时，可能临时选择其他节点)
+type OwnerPicker interface {
+	// 与 PickReplicas 相同，但返回的是不考虑负载时真正负责 key 的前 n 个节点
+	PickOwners(key string, n int) (peers []PeerGetter, self int)
+}
+
+// PeerPicker 实现了 SelfIdentifier 时，Group 通过它获取当前节点的标识 (比如日志中的节点地址)
+type SelfIdentifier interface {
+	Self() string
+}
+
+// PeerPicker 实现了 PeerLister 才能向集群中的所有其他节点广播缓存失效
+type PeerLister interface {
+	ListPeers() []PeerGetter  // 返回除自己以外的所有节点
+}
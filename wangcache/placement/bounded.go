@@ -0,0 +1,158 @@
+package placement
+
+import (
+	"7go/wangCache/wangcache/consistenthash"
+	"math"
+	"sync"
+)
+
+// 带负载上限的一致性哈希 (Consistent Hashing with Bounded Loads, Mirrokni et al. 2016)
+// 每个节点的负载上限为 ceil(factor * (总负载+1) / 节点数)，
+// key 对应的节点达到上限时，沿哈希环顺时针选择第一个没有达到上限的节点
+// 负载是当前节点发往各个节点、尚未完成的请求数，通过 LoadTracker 接口记录
+// 没有节点过载时，结果与普通的哈希环相同
+// 被顺延的节点只是临时分担读请求，key仍然属于它在哈希环上的节点 (见 Owners)
+type Bounded struct {
+	mu     sync.Mutex
+	ring   *consistenthash.Map
+	factor float64          // 负载上限是平均负载的多少倍，需要大于1
+	loads  map[string]int64 // 每个节点的负载
+	total  int64            // 所有节点的负载之和
+}
+
+var (
+	_ Placement   = (*Bounded)(nil)
+	_ LoadTracker = (*Bounded)(nil)
+	_ Owned       = (*Bounded)(nil)
+)
+
+// 默认的负载上限倍数，论文中推荐的取值范围是 1.25 ~ 2
+const defaultLoadFactor = 1.25
+
+// 新建带 replicas 倍虚拟节点、负载上限为平均负载 factor 倍的哈希环，factor <= 1 时使用默认值 1.25
+func NewBounded(replicas int, factor float64) *Bounded {
+	if factor <= 1 {
+		factor = defaultLoadFactor
+	}
+	return &Bounded{
+		ring:   consistenthash.New(replicas, nil),
+		factor: factor,
+		loads:  make(map[string]int64),
+	}
+}
+
+func (b *Bounded) Add(nodes ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, node := range nodes {
+		if _, ok := b.loads[node]; ok {
+			continue
+		}
+		b.ring.Add(node)
+		b.loads[node] = 0
+	}
+}
+
+func (b *Bounded) Remove(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	load, ok := b.loads[node]
+	if !ok {
+		return
+	}
+	b.ring.Remove(node)
+	b.total -= load
+	delete(b.loads, node)
+}
+
+func (b *Bounded) Nodes() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ring.Nodes()
+}
+
+func (b *Bounded) Get(key string) string {
+	nodes := b.GetN(key, 1)
+	if len(nodes) == 0 {
+		return ""
+	}
+	return nodes[0]
+}
+
+// 按哈希环的顺序，先返回没有达到负载上限的节点，再返回已经过载的节点
+func (b *Bounded) GetN(key string, n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.loads) == 0 || n <= 0 {
+		return nil
+	}
+
+	candidates := b.ring.GetN(key, len(b.loads))
+	limit := b.capacity()
+	nodes := make([]string, 0, n)
+	var overloaded []string
+	for _, node := range candidates {
+		if b.loads[node] < limit {
+			nodes = append(nodes, node)
+			if len(nodes) == n {
+				return nodes
+			}
+		} else {
+			overloaded = append(overloaded, node)
+		}
+	}
+	for _, node := range overloaded {
+		if len(nodes) == n {
+			break
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
+// 不考虑负载时 key 对应的 n 个节点，与普通的哈希环相同
+func (b *Bounded) Owners(key string, n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ring.GetN(key, n)
+}
+
+// 每个节点的负载上限，调用时需要持有 b.mu
+func (b *Bounded) capacity() int64 {
+	if len(b.loads) == 0 {
+		return 0
+	}
+	return int64(math.Ceil(b.factor * float64(b.total+1) / float64(len(b.loads))))
+}
+
+// 节点的负载加一
+func (b *Bounded) Inc(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.loads[node]; ok {
+		b.loads[node]++
+		b.total++
+	}
+}
+
+// 节点的负载减一
+func (b *Bounded) Done(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if load, ok := b.loads[node]; ok && load > 0 {
+		b.loads[node]--
+		b.total--
+	}
+}
+
+// 返回节点当前的负载
+func (b *Bounded) Load(node string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.loads[node]
+}
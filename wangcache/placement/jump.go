@@ -0,0 +1,75 @@
+package placement
+
+import "sort"
+
+// Jump consistent hash (Lamping & Veach, 2014)
+// 把 key 映射到 [0, n) 之间的编号，不需要虚拟节点，分布几乎完全均匀
+// 编号对应按名称排序后的节点，这样不论各节点以什么顺序得知其他节点 (gossip、健康检查的移出和恢复)，
+// 只要节点集合相同，同一个key就会选择同一个节点；
+// 代价是增删节点时排在它之后的节点编号都会改变，大部分key都会移动，因此只适合节点固定的集群 (只通过 Set 设置节点)
+type Jump struct {
+	nodes []string
+}
+
+var _ Placement = (*Jump)(nil)
+
+func NewJump() *Jump {
+	return &Jump{}
+}
+
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		if !contains(j.nodes, node) {
+			j.nodes = append(j.nodes, node)
+		}
+	}
+	sort.Strings(j.nodes)
+}
+
+func (j *Jump) Remove(node string) {
+	for i, n := range j.nodes {
+		if n == node {
+			j.nodes = append(j.nodes[:i], j.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (j *Jump) Nodes() []string {
+	return append([]string(nil), j.nodes...)
+}
+
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[jumpHash(hash64(key), len(j.nodes))]
+}
+
+// 第一个节点由 jump hash 选出，之后依次选择编号相邻的节点
+func (j *Jump) GetN(key string, n int) []string {
+	if len(j.nodes) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+
+	b := jumpHash(hash64(key), len(j.nodes))
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = j.nodes[(b+i)%len(j.nodes)]
+	}
+	return nodes
+}
+
+// 论文中的算法：key 依次 "跳" 到更大的编号，直到超过 buckets
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
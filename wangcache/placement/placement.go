@@ -0,0 +1,86 @@
+package placement
+
+import (
+	"7go/wangCache/wangcache/consistenthash"
+	"hash/fnv"
+	"sort"
+)
+
+//节点放置算法：根据key选择负责它的节点
+
+//  - Ring: 带虚拟节点的一致性哈希 (consistenthash.Map)，均衡程度取决于虚拟节点的数量
+//  - Rendezvous: 最高随机权重 (HRW) 哈希，每个key选择与它组合后哈希值最大的节点，不需要虚拟节点，但选择的复杂度为 O(节点数)
+//  - Jump: Google 的 jump consistent hash，不占用额外内存，分布非常均匀，但增删节点时大部分key都会移动，只适合节点固定的集群
+//  - Bounded: 带负载上限的一致性哈希，节点负载超过平均负载的一定倍数后，key会被顺延到哈希环上的下一个节点
+
+// 所有放置算法需要实现的接口，使用者需要自己保证并发安全 (HTTPPool 在持有锁时调用)
+type Placement interface {
+	Add(nodes ...string)             // 添加节点
+	Remove(node string)              // 移除节点
+	Get(key string) string           // 选择 key 对应的节点，没有任何节点时返回空字符串
+	GetN(key string, n int) []string // 选择 key 对应的 n 个不同的节点，第一个与 Get 的结果相同
+	Nodes() []string                 // 返回所有的节点，按名称排序
+}
+
+// 需要根据节点负载选择节点的放置算法 (如 Bounded) 实现该接口，
+// 使用者在访问节点前调用 Inc，访问结束后调用 Done，这两个方法需要是并发安全的
+type LoadTracker interface {
+	Inc(node string)
+	Done(node string)
+}
+
+// 根据负载选择节点的放置算法 (如 Bounded) 实现该接口：Get/GetN 的结果随负载变化，只用来选择读请求访问的节点，
+// Owners 返回不考虑负载时 key 对应的 n 个节点，即真正负责该key的节点，写操作总是路由到这些节点
+type Owned interface {
+	Owners(key string, n int) []string
+}
+
+// 支持节点权重的放置算法实现该接口，节点分配到的key的数量与权重成正比
+type Weighted interface {
+	AddWeighted(node string, weight int)
+}
+
+var (
+	_ Placement = (*consistenthash.Map)(nil)
+	_ Weighted  = (*consistenthash.Map)(nil)
+)
+
+// 新建带 replicas 倍虚拟节点的哈希环
+func NewRing(replicas int) Placement {
+	return consistenthash.New(replicas, nil)
+}
+
+// 64位的哈希函数: FNV-1a 加上 splitmix64 的混淆步骤
+// FNV 对末尾几个字节的变化不够敏感，混淆之后相近的输入也能得到差别很大的哈希值
+func hash64(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// 返回排序后的节点列表的副本
+func sortedNodes(nodes []string) []string {
+	sorted := make([]string, len(nodes))
+	copy(sorted, nodes)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// 判断节点是否已经存在
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
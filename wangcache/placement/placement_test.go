@@ -0,0 +1,207 @@
+package placement
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+const testKeys = 20000
+
+func testPlacements() map[string]func() Placement {
+	return map[string]func() Placement{
+		"ring":       func() Placement { return NewRing(50) },
+		"ring-200":   func() Placement { return NewRing(200) },
+		"rendezvous": func() Placement { return NewRendezvous() },
+		"jump":       func() Placement { return NewJump() },
+		"bounded":    func() Placement { return NewBounded(50, 1.25) },
+	}
+}
+
+func nodes(n int) []string {
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = "http://node" + strconv.Itoa(i)
+	}
+	return nodes
+}
+
+// 统计每个节点分配到的key的数量，返回最大值与平均值的比值
+func distribution(p Placement, n int) float64 {
+	counts := make(map[string]int)
+	for i := 0; i < testKeys; i++ {
+		counts[p.Get("key"+strconv.Itoa(i))]++
+	}
+	max := 0
+	for _, c := range counts {
+		if c > max {
+			max = c
+		}
+	}
+	return float64(max) / (float64(testKeys) / float64(n))
+}
+
+// 统计两次分配之间发生移动的key的比例
+func movement(p Placement, change func()) float64 {
+	before := make([]string, testKeys)
+	for i := range before {
+		before[i] = p.Get("key" + strconv.Itoa(i))
+	}
+	change()
+	moved := 0
+	for i := range before {
+		if p.Get("key"+strconv.Itoa(i)) != before[i] {
+			moved++
+		}
+	}
+	return float64(moved) / testKeys
+}
+
+func TestDistribution(t *testing.T) {
+	// 最大负载与平均负载的比值上限，虚拟节点越多越均匀
+	limits := map[string]float64{
+		"ring":       1.6,
+		"ring-200":   1.3,
+		"rendezvous": 1.1,
+		"jump":       1.1,
+		"bounded":    1.6,
+	}
+	for name, newPlacement := range testPlacements() {
+		p := newPlacement()
+		p.Add(nodes(10)...)
+		ratio := distribution(p, 10)
+		t.Logf("%-10s max/avg = %.3f", name, ratio)
+		if ratio > limits[name] {
+			t.Errorf("%s: max/avg = %.3f, expect <= %.2f", name, ratio, limits[name])
+		}
+	}
+}
+
+func TestMovement(t *testing.T) {
+	for name, newPlacement := range testPlacements() {
+		p := newPlacement()
+		p.Add(nodes(10)...)
+
+		// 增加一个节点，理想情况下移动 1/11 的key
+		added := movement(p, func() { p.Add("http://node10") })
+		// 移除中间的一个节点，理想情况下移动 1/11 的key
+		removed := movement(p, func() { p.Remove("http://node3") })
+		t.Logf("%-10s add: %.3f remove: %.3f", name, added, removed)
+
+		// jump 的编号按节点名称排序，增删节点时大部分key都会移动，只适合节点固定的集群
+		if name == "jump" {
+			continue
+		}
+		expect := 1.0 / 11
+		if added > expect*1.6 {
+			t.Errorf("%s: %.3f keys moved after adding a node, expect about %.3f", name, added, expect)
+		}
+		if removed > expect*1.6 {
+			t.Errorf("%s: %.3f keys moved after removing a node, expect about %.3f", name, removed, expect)
+		}
+	}
+}
+
+// 节点集合相同时，不论以什么顺序添加和移除节点，同一个key都选择同一个节点
+func TestAddOrder(t *testing.T) {
+	for name, newPlacement := range testPlacements() {
+		a, b := newPlacement(), newPlacement()
+		a.Add(nodes(6)...)
+		all := nodes(7)
+		for i := len(all) - 1; i >= 0; i-- {
+			b.Add(all[i])
+		}
+		b.Remove("http://node2")
+		b.Add("http://node2")
+		b.Remove("http://node6")
+
+		if !reflect.DeepEqual(a.Nodes(), b.Nodes()) {
+			t.Fatalf("%s: expect nodes %v, but got %v", name, a.Nodes(), b.Nodes())
+		}
+		for i := 0; i < 1000; i++ {
+			key := "key" + strconv.Itoa(i)
+			if x, y := a.GetN(key, 3), b.GetN(key, 3); !reflect.DeepEqual(x, y) {
+				t.Fatalf("%s: GetN(%s, 3) = %v and %v for different add orders", name, key, x, y)
+			}
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	for name, newPlacement := range testPlacements() {
+		p := newPlacement()
+		if p.Get("Tom") != "" || p.GetN("Tom", 2) != nil {
+			t.Errorf("%s: expect no node when empty", name)
+		}
+
+		p.Add(nodes(5)...)
+		p.Add("http://node1") // 重复添加会被忽略
+		for i := 0; i < 100; i++ {
+			key := "key" + strconv.Itoa(i)
+			got := p.GetN(key, 3)
+			if len(got) != 3 || got[0] != p.Get(key) {
+				t.Fatalf("%s: unexpected GetN(%s, 3) = %v, Get = %s", name, key, got, p.Get(key))
+			}
+			seen := make(map[string]bool)
+			for _, node := range got {
+				if seen[node] {
+					t.Fatalf("%s: duplicated node in %v", name, got)
+				}
+				seen[node] = true
+			}
+			if all := p.GetN(key, 10); len(all) != 5 {
+				t.Fatalf("%s: expect all 5 nodes, but got %v", name, all)
+			}
+		}
+
+		if got := p.Nodes(); !reflect.DeepEqual(got, nodes(5)) {
+			t.Errorf("%s: unexpected nodes %v", name, got)
+		}
+		p.Remove("http://unknown") // 移除不存在的节点不影响结果
+		if got := p.GetN("Tom", 5); len(got) != 5 {
+			t.Errorf("%s: unexpected nodes %v after removing an unknown node", name, got)
+		}
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	b := NewBounded(50, 1.25)
+	b.Add(nodes(4)...)
+
+	// 没有负载时与普通的哈希环结果相同
+	ring := NewRing(50)
+	ring.Add(nodes(4)...)
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		if b.Get(key) != ring.Get(key) {
+			t.Fatalf("expect the same node as ring for %s when there is no load", key)
+		}
+	}
+
+	// 所有请求都访问同一个热点key，并且都没有结束，负载会被分摊到其他节点，且不超过上限
+	for i := 1; i <= 100; i++ {
+		b.Inc(b.Get("hot"))
+		limit := math.Ceil(1.25 * float64(i) / 4)
+		for _, node := range nodes(4) {
+			if float64(b.Load(node)) > limit {
+				t.Fatalf("load of %s is %d after %d requests, expect <= %.0f", node, b.Load(node), i, limit)
+			}
+		}
+	}
+
+	// 负责该key的节点不随负载变化
+	if !reflect.DeepEqual(b.Owners("hot", 4), ring.GetN("hot", 4)) {
+		t.Fatalf("expect the owners to be the same as ring under load")
+	}
+
+	// 请求结束后，热点key回到原来的节点
+	for _, node := range nodes(4) {
+		for b.Load(node) > 0 {
+			b.Done(node)
+		}
+	}
+	if !reflect.DeepEqual(b.GetN("hot", 4), ring.GetN("hot", 4)) {
+		t.Fatalf("expect the same nodes as ring after all requests are done")
+	}
+}
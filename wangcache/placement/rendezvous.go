@@ -0,0 +1,80 @@
+package placement
+
+import "sort"
+
+// 最高随机权重 (Highest Random Weight) 哈希
+// 每个 key 对所有节点计算 hash(node, key)，选择哈希值最大的节点
+// 增删节点时只有属于该节点的key会移动，且移动的key被均匀地分配给其他节点
+type Rendezvous struct {
+	nodes []string
+}
+
+var _ Placement = (*Rendezvous)(nil)
+
+func NewRendezvous() *Rendezvous {
+	return &Rendezvous{}
+}
+
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		if !contains(r.nodes, node) {
+			r.nodes = append(r.nodes, node)
+		}
+	}
+}
+
+func (r *Rendezvous) Remove(node string) {
+	for i, n := range r.nodes {
+		if n == node {
+			r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *Rendezvous) Nodes() []string {
+	return sortedNodes(r.nodes)
+}
+
+func (r *Rendezvous) Get(key string) string {
+	var best string
+	var bestScore uint64
+	for _, node := range r.nodes {
+		score := hash64(node, key)
+		// 哈希值相同时选择名称较小的节点，保证结果与节点的添加顺序无关
+		if best == "" || score > bestScore || (score == bestScore && node < best) {
+			best, bestScore = node, score
+		}
+	}
+	return best
+}
+
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if len(r.nodes) == 0 || n <= 0 {
+		return nil
+	}
+
+	type scored struct {
+		node  string
+		score uint64
+	}
+	nodes := make([]scored, len(r.nodes))
+	for i, node := range r.nodes {
+		nodes[i] = scored{node, hash64(node, key)}
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].score != nodes[j].score {
+			return nodes[i].score > nodes[j].score
+		}
+		return nodes[i].node < nodes[j].node
+	})
+
+	if n > len(nodes) {
+		n = len(nodes)
+	}
+	result := make([]string, n)
+	for i := range result {
+		result[i] = nodes[i].node
+	}
+	return result
+}
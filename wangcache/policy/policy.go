@@ -0,0 +1,36 @@
+package policy
+
+import "time"
+
+//定义缓存淘汰策略的公共接口
+//常用的缓存淘汰(失效)算法：FIFO，LFU 和 LRU，以及在它们基础上改进的 ARC、W-TinyLFU 等
+//每种算法放在各自的包中实现 (lru、lfu、fifo、arc、tinylfu)，cache 只依赖这里定义的接口
+
+// Value use Len() to count how many bytes it takes
+type Value interface {
+	Len() int // 用于返回值所占用的内存大小
+}
+
+// Cache 是各个淘汰算法需要实现的接口，实现都不需要保证并发安全，由调用方加锁
+// 所有实现都遵循相同的约定：
+//   - 每条记录占用的字节数为 len(key) + value.Len()
+//   - maxBytes 为 0 表示不限制内存，不会淘汰任何记录
+//   - 记录因淘汰或过期被移除时，调用 OnEvicted 回调 (可以为 nil)
+type Cache interface {
+	// 新增/修改缓存，永不过期
+	Add(key string, value Value)
+	// 新增/修改缓存，并设置过期时间；ttl <= 0 表示永不过期
+	AddWithTTL(key string, value Value, ttl time.Duration)
+	// 获取缓存，已过期的记录会被惰性移除
+	Get(key string) (value Value, ok bool)
+	// 移除指定的缓存
+	Remove(key string)
+	// 清空所有缓存
+	Purge()
+	// 移除所有已过期的记录，返回移除的数量
+	RemoveExpired() int
+	// 缓存中记录的数量
+	Len() int
+	// 缓存中所有记录占用的字节数
+	Bytes() int64
+}
@@ -0,0 +1,114 @@
+package wangcache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Registry 保存着一组缓存实例 (Group)，以及它们共用的 PeerPicker
+//一个进程中可以有多个互相独立的 Registry，比如同时运行两个逻辑上的缓存，或者并行运行的测试中使用同名的group；
+//包级别的 NewGroup/GetGroup/DeleteGroup 操作的是 DefaultRegistry
+
+// Registry.NewGroup 时同名的group已经存在
+var ErrGroupExists = errors.New("wangcache: group already exists")
+
+type Registry struct {
+	mu     sync.RWMutex
+	groups map[string]*Group // key是对应缓存的命名空间name
+	peers  PeerPicker        // 注册到之后新建的所有group，为 nil 时group工作在单机模式下
+}
+
+// 包级别函数使用的 Registry，HTTPPool 默认也从这里查找group
+var DefaultRegistry = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{groups: make(map[string]*Group)}
+}
+
+// 在 Registry 中新建一个缓存实例，同名的group已经存在时返回 ErrGroupExists
+// 通过 RegisterPeers 设置过 PeerPicker 时，新建的group会自动注册它 (可以再通过 Group.RegisterPeers 替换)
+func (r *Registry) NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) (*Group, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.groups[name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrGroupExists, name)
+	}
+	g := newGroup(name, cacheBytes, getter, opts...)
+	if r.peers != nil {
+		g.inheritPeers(r.peers)
+	}
+	r.groups[name] = g
+	return g, nil
+}
+
+// 添加group，同名的group会被替换 (包级别的 NewGroup 保留了这一行为)
+func (r *Registry) replace(g *Group) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.peers != nil {
+		g.inheritPeers(r.peers)
+	}
+	// 需要停止旧Group的后台清理goroutine
+	if old, ok := r.groups[g.name]; ok {
+		old.stop()
+	}
+	r.groups[g.name] = g
+}
+
+// 获取指定name的Group实例，不存在时返回 nil
+func (r *Registry) GetGroup(name string) *Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.groups[name]
+}
+
+// 删除指定name的Group并停止它的后台清理goroutine，返回group是否存在
+// 已经获取到该Group的调用方仍然可以继续使用它，但其他节点再也访问不到这个group
+func (r *Registry) DeleteGroup(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, ok := r.groups[name]
+	if !ok {
+		return false
+	}
+	g.stop()
+	delete(r.groups, name)
+	return true
+}
+
+// 返回所有的Group，按名称排序
+func (r *Registry) Groups() []*Group {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	groups := make([]*Group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
+
+// 设置 Registry 中所有group使用的 PeerPicker，已经存在且还没有注册过 PeerPicker 的group同样会注册它
+// 与 Group.RegisterPeers 一样只能调用一次
+// 自动注册的 PeerPicker 只是默认值：之后仍然可以对某个group调用 Group.RegisterPeers 替换它，不会 panic；
+// 已经通过 Group.RegisterPeers 注册过的group保持不变
+func (r *Registry) RegisterPeers(peers PeerPicker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.peers != nil {
+		panic("RegisterPeers called more than once")
+	}
+	r.peers = peers
+	for _, g := range r.groups {
+		g.inheritPeers(peers)
+	}
+}
@@ -0,0 +1,127 @@
+package wangcache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	})
+
+	r1, r2 := NewRegistry(), NewRegistry()
+	g1, err := r1.NewGroup("scores", 2<<10, getter)
+	if err != nil {
+		t.Fatalf("failed to create group, err: %v", err)
+	}
+	if _, err := r1.NewGroup("scores", 2<<10, getter); !errors.Is(err, ErrGroupExists) {
+		t.Fatalf("expect ErrGroupExists, but got %v", err)
+	}
+	// 不同的 Registry 中可以有同名的group
+	g2, err := r2.NewGroup("scores", 2<<10, getter)
+	if err != nil || g2 == g1 {
+		t.Fatalf("expect an independent group in another registry, err: %v", err)
+	}
+	if r1.GetGroup("scores") != g1 || r2.GetGroup("scores") != g2 {
+		t.Fatalf("registries should own their groups")
+	}
+
+	if !r1.DeleteGroup("scores") || r1.DeleteGroup("scores") {
+		t.Fatalf("expect group to be deleted exactly once")
+	}
+	if r1.GetGroup("scores") != nil || r2.GetGroup("scores") != g2 {
+		t.Fatalf("DeleteGroup should only affect its own registry")
+	}
+	if _, err := r1.NewGroup("scores", 2<<10, getter); err != nil {
+		t.Fatalf("expect name to be reusable after delete, err: %v", err)
+	}
+
+	// 包级别的 NewGroup 保留替换同名group的行为
+	old := NewGroup("registry-replace", 2<<10, getter)
+	if g := NewGroup("registry-replace", 2<<10, getter); g == old || GetGroup("registry-replace") != g {
+		t.Fatalf("global NewGroup should replace the existing group")
+	}
+}
+
+func TestRegistryPeers(t *testing.T) {
+	r := NewRegistry()
+	before, _ := r.NewGroup("before", 2<<10, GetterFunc(func(key string) ([]byte, error) { return nil, nil }))
+	pool := NewHTTPPool("http://self", WithRegistry(r))
+	r.RegisterPeers(pool)
+	after, _ := r.NewGroup("after", 2<<10, GetterFunc(func(key string) ([]byte, error) { return nil, nil }))
+
+	if before.peers != pool || after.peers != pool {
+		t.Fatalf("groups in registry should use the registered peers")
+	}
+	if groups := r.Groups(); len(groups) != 2 || groups[0] != after || groups[1] != before {
+		t.Fatalf("expect groups sorted by name, but got %v", groups)
+	}
+
+	// 自动注册的 PeerPicker 可以被 Group.RegisterPeers 替换，显式注册的不会被 Registry 覆盖
+	other := NewHTTPPool("http://other", WithRegistry(r))
+	after.RegisterPeers(other)
+	if after.peers != other {
+		t.Fatalf("expect RegisterPeers to replace the peers from registry")
+	}
+	explicit := newGroup("explicit", 2<<10, GetterFunc(func(key string) ([]byte, error) { return nil, nil }))
+	explicit.RegisterPeers(other)
+	r2 := NewRegistry()
+	r2.replace(explicit)
+	r2.RegisterPeers(pool)
+	if explicit.peers != other {
+		t.Fatalf("expect explicitly registered peers to be kept")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expect the second explicit RegisterPeers to panic")
+		}
+	}()
+	after.RegisterPeers(pool)
+}
+
+// 同一个进程中启动两个节点，各自使用独立的 Registry 和同名的group
+func TestTwoNodes(t *testing.T) {
+	pools := make([]*HTTPPool, 2)
+	urls := make([]string, 2)
+	for i := range pools {
+		i := i
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pools[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(srv.Close)
+		urls[i] = srv.URL
+	}
+
+	groups := make([]*Group, 2)
+	for i := range pools {
+		i := i
+		r := NewRegistry()
+		pools[i] = NewHTTPPool(urls[i], WithRegistry(r))
+		pools[i].Set(urls...)
+		r.RegisterPeers(pools[i])
+		groups[i], _ = r.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte("node" + strconv.Itoa(i) + ":" + key), nil
+		}))
+	}
+
+	remote := 0
+	for j := 0; j < 20; j++ {
+		key := "key" + strconv.Itoa(j)
+		owner := 0
+		if _, ok := pools[0].PickPeer(key); ok {
+			owner = 1
+			remote++
+		}
+		view, err := groups[0].Get(key)
+		if want := "node" + strconv.Itoa(owner) + ":" + key; err != nil || view.String() != want {
+			t.Fatalf("expect %s, but got %q, err: %v", want, view, err)
+		}
+	}
+	if remote == 0 {
+		t.Fatalf("expect some keys to be owned by the other node")
+	}
+}
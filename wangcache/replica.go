@@ -0,0 +1,56 @@
+package wangcache
+
+//多副本：每个key由哈希环上连续的 n 个不同节点负责
+//主节点宕机时，其他节点可以从副本节点获取缓存值，而不是全部回源查询数据源
+
+// 返回负责 key 的远程节点 (按优先级排序)，以及当前节点在所有负责节点中的位置 (-1 表示当前节点不负责)
+// 未开启多副本时，最多只有一个负责节点，与 PickPeer 的结果一致
+func (g *Group) pickReplicas(key string) ([]PeerGetter, int) {
+	if g.peers == nil {
+		return nil, 0
+	}
+	if picker, ok := g.peers.(ReplicaPicker); ok && g.replicas > 1 {
+		peers, self := picker.PickReplicas(key, g.replicas)
+		// 哈希环上没有任何节点时在本地处理
+		if len(peers) == 0 && self < 0 {
+			self = 0
+		}
+		return peers, self
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}, -1
+	}
+	return nil, 0
+}
+
+// 与 pickReplicas 相同，但返回的是真正负责 key 的节点，用于写操作以及判断加载到的数据保存在哪里
+// PeerPicker 没有实现 OwnerPicker 时与 pickReplicas 的结果相同
+func (g *Group) pickOwners(key string) ([]PeerGetter, int) {
+	picker, ok := g.peers.(OwnerPicker)
+	if !ok {
+		return g.pickReplicas(key)
+	}
+	n := g.replicas
+	if n < 1 {
+		n = 1
+	}
+	peers, self := picker.PickOwners(key, n)
+	if len(peers) == 0 && self < 0 {
+		self = 0
+	}
+	return peers, self
+}
+
+// 将当前节点加载到的缓存值写入副本节点
+// 写入失败不影响本次获取的结果，只记录日志，副本节点之后会在需要时自己加载
+func (g *Group) replicate(key string, value ByteView, peers []PeerGetter) {
+	for _, peer := range peers {
+		setter, ok := peer.(PeerSetter)
+		if !ok {
+			continue
+		}
+		if err := setter.Set(g.name, key, value.ByteSlice()); err != nil {
+			g.logger.Warn("failed to replicate key to peer", "group", g.name, "self", g.self(), "key", key, "peer", peerName(peer), "error", err)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package wangcache
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 返回负责节点恰好为 owners 的key
+func replicaKey(t *testing.T, pool *HTTPPool, owners ...string) string {
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		if reflect.DeepEqual(pool.peers.GetN(key, len(owners)), owners) {
+			return key
+		}
+	}
+	t.Fatalf("no key is owned by %v", owners)
+	return ""
+}
+
+func TestReplicaFallback(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	alive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("630"))
+	}))
+	defer alive.Close()
+
+	group := NewGroup("replica-fallback", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		t.Fatalf("key [%s] should be loaded from the replica", key)
+		return nil, nil
+	}), WithReplication(2, false))
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", dead.URL, alive.URL)
+	group.RegisterPeers(pool)
+
+	// 主节点宕机，从副本节点获取
+	key := replicaKey(t, pool, dead.URL, alive.URL)
+	if view, err := group.Get(key); err != nil || view.String() != "630" {
+		t.Fatalf("failed to get %s from the replica, err: %v", key, err)
+	}
+}
+
+// 多副本写入时某个节点失败：其他节点和本地仍然写入，失败的节点上的旧值被删除
+func TestSetPartialFailure(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string][]string)
+	handler := func(name string, status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[name] = append(requests[name], r.Method)
+			mu.Unlock()
+			if r.Method == http.MethodPut {
+				w.WriteHeader(status)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+	failed := httptest.NewServer(handler("failed", http.StatusInternalServerError))
+	defer failed.Close()
+	good := httptest.NewServer(handler("good", http.StatusNoContent))
+	defer good.Close()
+
+	group := NewGroup("replica-partial", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}), WithReplication(3, false))
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", failed.URL, good.URL)
+	group.RegisterPeers(pool)
+
+	// 失败的节点排在最前面，之后的节点和本地仍然需要写入
+	key := replicaKey(t, pool, failed.URL, "http://self", good.URL)
+	err := group.Set(key, []byte("700"))
+	if err == nil || !strings.Contains(err.Error(), failed.URL) || strings.Contains(err.Error(), good.URL) {
+		t.Fatalf("expect an error naming only the failed peer, but got %v", err)
+	}
+	if view, ok := group.mainCache.get(key); !ok || view.String() != "700" {
+		t.Fatalf("expect %s=700 to be set locally, but got %q", key, view)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if expect := []string{http.MethodPut, http.MethodDelete}; !reflect.DeepEqual(requests["failed"], expect) {
+		t.Fatalf("expect %v on the failed peer, but got %v", expect, requests["failed"])
+	}
+	if expect := []string{http.MethodPut}; !reflect.DeepEqual(requests["good"], expect) {
+		t.Fatalf("expect %v on the other peer, but got %v", expect, requests["good"])
+	}
+}
+
+func TestWriteThrough(t *testing.T) {
+	var mu sync.Mutex
+	requests := make([]string, 0)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, fmt.Sprintf("%s %s %s", r.Method, r.Header.Get(forwardedHeader), body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer remote.Close()
+
+	var loads int32
+	group := NewGroup("replica-write", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte("630"), nil
+	}), WithReplication(2, true))
+	pool := NewHTTPPool("http://self")
+	pool.Set("http://self", remote.URL)
+	group.RegisterPeers(pool)
+
+	// 当前节点是主节点：从数据源加载后写入副本节点
+	key := replicaKey(t, pool, "http://self", remote.URL)
+	for i := 0; i < 2; i++ {
+		if view, err := group.Get(key); err != nil || view.String() != "630" {
+			t.Fatalf("failed to get %s, err: %v", key, err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect %s to be loaded once, but got %d", key, loads)
+	}
+
+	// 当前节点是副本节点：Set/Remove 同时作用于主节点和本地
+	key = replicaKey(t, pool, remote.URL, "http://self")
+	if err := group.Set(key, []byte("700")); err != nil {
+		t.Fatalf("failed to set %s, err: %v", key, err)
+	}
+	if view, ok := group.mainCache.get(key); !ok || view.String() != "700" {
+		t.Fatalf("expect %s to be set locally on the replica", key)
+	}
+	if err := group.Remove(key); err != nil {
+		t.Fatalf("failed to remove %s, err: %v", key, err)
+	}
+	if _, ok := group.mainCache.get(key); ok {
+		t.Fatalf("expect %s to be removed locally on the replica", key)
+	}
+
+	expect := []string{"PUT 1 630", "PUT 1 700", "DELETE 1 "}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(expect, requests) {
+		t.Fatalf("expect requests %q, but got %q", expect, requests)
+	}
+}
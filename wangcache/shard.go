@@ -0,0 +1,109 @@
+package wangcache
+
+import "time"
+
+//分片缓存：将缓存按key的哈希值拆分为多个独立加锁的分片，减少并发访问时的锁竞争
+//cache 中只有一把互斥锁，而且由于 LRU 在 get 时也需要调整链表，读操作同样要加互斥锁，
+//在读多写少、并发很高的场景下所有请求都会在这把锁上排队。分片之后不同分片上的key可以并行访问。
+
+// store 是 Group 主缓存需要实现的接口，cache 和 shardedCache 都实现了它
+type store interface {
+	add(key string, value ByteView)
+	get(key string) (value ByteView, ok bool)
+	remove(key string)
+	purge()
+	removeExpired() int
+	stats() (items, bytes, evictions int64)
+	startReaper(interval time.Duration)
+	stopReaper()
+}
+
+var (
+	_ store = (*cache)(nil)
+	_ store = (*shardedCache)(nil)
+)
+
+// 根据分片数量创建主缓存，shards <= 1 时不分片
+// 每个分片至少分配1字节，cacheBytes 少于分片数量时减少分片，否则分片的 cacheBytes 为0会被当作不限制
+func newStore(cacheBytes int64, p EvictionPolicy, shards int) store {
+	if cacheBytes > 0 && int64(shards) > cacheBytes {
+		shards = int(cacheBytes)
+	}
+	if shards <= 1 {
+		return &cache{cacheBytes: cacheBytes, policy: p}
+	}
+	return newShardedCache(shards, cacheBytes, p)
+}
+
+type shardedCache struct {
+	shards []*cache
+}
+
+// 新建分片缓存，cacheBytes 平均分配给每个分片
+func newShardedCache(n int, cacheBytes int64, p EvictionPolicy) *shardedCache {
+	s := &shardedCache{shards: make([]*cache, n)}
+	for i := range s.shards {
+		s.shards[i] = &cache{cacheBytes: cacheBytes / int64(n), policy: p}
+	}
+	// cacheBytes 不能被整除时，余下的字节分给第一个分片
+	s.shards[0].cacheBytes += cacheBytes % int64(n)
+	return s
+}
+
+// 使用 FNV-1a 哈希算法根据key选择分片 (内联实现，避免每次调用都分配 hash.Hash)
+func (s *shardedCache) shard(key string) *cache {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return s.shards[h%uint32(len(s.shards))]
+}
+
+func (s *shardedCache) add(key string, value ByteView) {
+	s.shard(key).add(key, value)
+}
+
+func (s *shardedCache) get(key string) (value ByteView, ok bool) {
+	return s.shard(key).get(key)
+}
+
+func (s *shardedCache) remove(key string) {
+	s.shard(key).remove(key)
+}
+
+func (s *shardedCache) purge() {
+	for _, c := range s.shards {
+		c.purge()
+	}
+}
+
+func (s *shardedCache) removeExpired() int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.removeExpired()
+	}
+	return n
+}
+
+func (s *shardedCache) stats() (items, bytes, evictions int64) {
+	for _, c := range s.shards {
+		i, b, e := c.stats()
+		items += i
+		bytes += b
+		evictions += e
+	}
+	return
+}
+
+func (s *shardedCache) startReaper(interval time.Duration) {
+	for _, c := range s.shards {
+		c.startReaper(interval)
+	}
+}
+
+func (s *shardedCache) stopReaper() {
+	for _, c := range s.shards {
+		c.stopReaper()
+	}
+}
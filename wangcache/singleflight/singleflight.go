@@ -1,6 +1,12 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
 
 // 在一瞬间有大量请求get(key)，而且key未被缓存或者未被缓存在当前节点 如果不用singleflight，那么这些请求都会发送远端节点或者从本地数据库读取，会造成远端节点或本地数据库压力猛增。
 // 使用singleflight，第一个get(key)请求到来时，singleflight会记录当前key正在被处理，后续的请求只需要等待第一个请求处理完成，取返回值即可。
@@ -19,8 +25,39 @@ type call struct {
 	wg  sync.WaitGroup  // 使用 sync.WaitGroup锁避免重入
 	val interface{}
 	err error
+
+	dups    int                 // 共享这次调用结果的其他请求数量，用于返回 shared
+	chans   []chan<- Result     // DoChan/DoContext 的等待者
+	waiters int                 // 还在等待结果的请求数量，DoContext 的等待者全部离开后取消 fn
+	cancel  context.CancelFunc  // 取消 DoContext 传给 fn 的 ctx，Do/DoChan 发起的调用为 nil
+}
+
+// Result 是 DoChan 返回的结果
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool  // 结果是否被多个请求共享
+}
+
+// fn 发生 panic 时，所有等待该 key 的请求都会收到这个 panic (Do/DoContext 重新 panic，DoChan 作为 Err 返回)，
+// 而不是一直阻塞下去
+type PanicError struct {
+	Value interface{}  // recover() 得到的值
+	Stack []byte       // 发生 panic 时的调用栈
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("singleflight: panic in fn: %v\n\n%s", p.Value, p.Stack)
+}
+
+func (p *PanicError) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
 }
 
+// fn 中调用了 runtime.Goexit (比如测试中的 t.FailNow) 时，等待者收到的错误
+var errGoexit = errors.New("singleflight: runtime.Goexit was called")
+
 // 管理每个key各自的请求(call)
 type Group struct {
 	mu sync.Mutex
@@ -28,7 +65,8 @@ type Group struct {
 }
 
 // Do 的作用就是，针对相同的 key，无论 Do 被调用多少次，函数 fn 都只会被调用一次，等待 fn 调用结束了，返回返回值或错误。
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// shared 表示结果是否同时返回给了其他请求
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
@@ -37,52 +75,158 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	// 如果指定key已经存在对应的call，那么就通过Wait等待call的结束 (call结束后就有了数据或错误信息)
 	// 由此就避免了针对同一个key的重复且无效的请求
 	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
 		g.mu.Unlock()
 		c.wg.Wait()
-		return c.val, c.err
+		if e, ok := c.err.(*PanicError); ok {
+			panic(e)
+		}
+		return c.val, c.err, true
 	}
 
-	c := new(call)
-	c.wg.Add(1)
-	g.m[key] = c
+	c := g.newCall(key, nil)
 	g.mu.Unlock()
 
 	// 调用函数，函数本身就是获取数据的实现 (通常都是访问其他节点获取缓存值)
-	c.val, c.err = fn()
-	c.wg.Done()
+	shared = g.doCall(c, key, fn)
+	if e, ok := c.err.(*PanicError); ok {
+		panic(e)
+	}
+	return c.val, c.err, shared
+}
 
+// DoChan 与 Do 相同，但不阻塞，而是返回一个在 fn 结束后接收结果的 channel
+// fn 在新的 goroutine 中执行，调用方可以配合 select 放弃等待
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
 	g.mu.Lock()
-	delete(g.m, key)
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.waiters++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+
+	c := g.newCall(key, nil)
+	c.chans = append(c.chans, ch)
 	g.mu.Unlock()
 
-	return c.val, c.err
+	go g.doCall(c, key, fn)
+	return ch
 }
 
+// DoContext 与 Do 相同，但 ctx 被取消或超时后立即返回 ctx.Err()，不再等待 fn 结束
+// fn 在新的 goroutine 中执行，收到的 ctx 保留了发起调用的请求的值和截止时间，但不会因为该请求被取消而取消：
+// 只有所有等待该 key 的请求都已经离开时才会被取消，避免一个请求被取消导致其他共享结果的请求一起失败
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	if err := ctx.Err(); err != nil {
+		return nil, err, false
+	}
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if ok {
+		c.dups++
+		c.waiters++
+		c.chans = append(c.chans, ch)
+	} else {
+		callCtx, cancel := detach(ctx)
+		c = g.newCall(key, cancel)
+		c.chans = append(c.chans, ch)
+		go func() {
+			defer cancel()
+			g.doCall(c, key, func() (interface{}, error) {
+				return fn(callCtx)
+			})
+		}()
+	}
+	g.mu.Unlock()
 
+	select {
+	case res := <-ch:
+		if e, ok := res.Err.(*PanicError); ok {
+			panic(e)
+		}
+		return res.Val, res.Err, res.Shared
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		c.waiters--
+		if c.waiters == 0 && c.cancel != nil {
+			// 没有请求再等待这个结果了，取消 fn，之后的请求重新发起调用
+			c.cancel()
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+		}
+		return nil, ctx.Err(), c.dups > 0
+	}
+}
 
+// Forget 让 Group 忘记正在进行中的 key，之后对该 key 的调用会重新执行 fn，而不是等待当前这次调用
+// 用于放弃一次卡住的调用，已经在等待的请求仍然会收到它的结果
+func (g *Group) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+}
 
+// 创建一个新的 call 并记录下来，调用时需要持有 g.mu
+func (g *Group) newCall(key string, cancel context.CancelFunc) *call {
+	c := &call{waiters: 1, cancel: cancel}
+	c.wg.Add(1)
+	g.m[key] = c
+	return c
+}
 
+// 执行 fn 并把结果通知给所有等待者，fn 发生 panic 或调用 runtime.Goexit 时同样会通知，不会让等待者一直阻塞
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) (shared bool) {
+	normalReturn := false
+	defer func() {
+		if !normalReturn {
+			if r := recover(); r != nil {
+				if e, ok := r.(*PanicError); ok {
+					// fn 重新抛出的 PanicError (比如来自其他 goroutine)，保留原来的调用栈
+					c.err = e
+				} else {
+					c.err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			} else {
+				c.err = errGoexit
+			}
+		}
+
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		c.wg.Done()
+		// Forget 之后同一个 key 可能已经有了新的 call
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		shared = c.dups > 0
+		for _, ch := range c.chans {
+			ch <- Result{Val: c.val, Err: c.err, Shared: shared}
+		}
+	}()
 
+	c.val, c.err = fn()
+	normalReturn = true
+	return
+}
 
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
-
+// 返回一个不会随 ctx 取消的 context，保留 ctx 中的值和截止时间，以及取消它的函数
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
@@ -0,0 +1,203 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil || shared {
+		t.Fatalf("Do = %v, %v, %v", v, err, shared)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	var shared int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, s := g.Do("key", fn)
+			if v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	// 等待所有请求都进入等待状态
+	for {
+		g.mu.Lock()
+		c := g.m["key"]
+		waiting := c != nil && c.waiters == n
+		g.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("expect fn to be called once, but got %d", calls)
+	}
+	if shared != n {
+		t.Fatalf("expect all %d results to be shared, but got %d", n, shared)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+	ch2 := g.DoChan("key", func() (interface{}, error) {
+		t.Errorf("fn should not be called for a pending key")
+		return nil, nil
+	})
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		res := <-ch
+		if res.Val != "bar" || res.Err != nil || !res.Shared {
+			t.Fatalf("DoChan = %+v", res)
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+
+	// 忘记卡住的调用后，新的请求重新执行 fn
+	g.Forget("key")
+	v, _, _ := g.Do("key", func() (interface{}, error) {
+		return 2, nil
+	})
+	if v != 2 {
+		t.Fatalf("expect a new call after Forget, but got %v", v)
+	}
+
+	close(release)
+	if res := <-first; res.Val != 1 {
+		t.Fatalf("the forgotten call should still deliver its result, but got %v", res.Val)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+
+	ch := g.DoChan("key", fn)
+	waiter := make(chan interface{})
+	go func() {
+		defer func() { waiter <- recover() }()
+		g.Do("key", fn)
+	}()
+	for {
+		g.mu.Lock()
+		waiting := g.m["key"].waiters == 2
+		g.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	// 等待者收到 panic 而不是一直阻塞
+	if r, ok := (<-waiter).(*PanicError); !ok || r.Value != "boom" {
+		t.Fatalf("expect waiter to panic with PanicError, but got %v", r)
+	}
+	var perr *PanicError
+	if res := <-ch; !errors.As(res.Err, &perr) {
+		t.Fatalf("expect PanicError from DoChan, but got %v", res.Err)
+	}
+
+	// key 不会一直卡住
+	if v, _, _ := g.Do("key", func() (interface{}, error) { return "ok", nil }); v != "ok" {
+		t.Fatalf("key should be released after panic, but got %v", v)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{ctx1, ctx2} {
+		go func(ctx context.Context) {
+			_, err, _ := g.DoContext(ctx, "key", fn)
+			errs <- err
+		}(ctx)
+	}
+	for {
+		g.mu.Lock()
+		c := g.m["key"]
+		waiting := c != nil && c.waiters == 2
+		g.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 一个请求离开后，其他请求仍在等待，fn 不会被取消
+	cancel1()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect Canceled, but got %v", err)
+	}
+	select {
+	case <-cancelled:
+		t.Fatalf("fn should not be cancelled while others are waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// 最后一个请求离开后，fn 被取消
+	cancel2()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect Canceled, but got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatalf("fn should be cancelled after all waiters left")
+	}
+}
@@ -0,0 +1,51 @@
+package wangcache
+
+import "sync/atomic"
+
+//统计数据：命中率、加载次数以及与其他节点之间的流量
+//计数器在请求的处理过程中通过原子操作更新，不需要加锁；缓存占用的字节数等数据在调用 Stats 时从缓存中读取
+
+// Stats 是 Group 统计数据的快照，计数器都是从 Group 创建以来的累计值
+type Stats struct {
+	Gets       int64 // 获取请求的次数，GetMulti 中的每个key各计一次
+	Hits       int64 // 不需要加载就得到结果的次数 (命中 mainCache/hotCache，或者被负缓存、布隆过滤器拒绝)
+	Misses     int64 // 未命中缓存、需要加载的次数
+	PeerLoads  int64 // 从远程节点获取成功的次数 (包括远程节点确认key不存在)
+	PeerErrors int64 // 访问远程节点失败的次数
+	LocalLoads int64 // 调用 Getter 从数据源加载的次数
+	Dedups     int64 // 被 singleflight 合并、直接使用其他请求加载结果的次数
+	Evictions  int64 // mainCache 和 hotCache 中因容量不足或过期被移除的记录数
+	Bytes      int64 // mainCache 和 hotCache 当前占用的字节数
+	Items      int64 // mainCache 和 hotCache 中的记录数
+}
+
+// Group 中通过原子操作更新的计数器
+type groupStats struct {
+	gets       int64
+	hits       int64
+	misses     int64
+	peerLoads  int64
+	peerErrors int64
+	localLoads int64
+	dedups     int64
+}
+
+// 返回当前的统计数据
+func (g *Group) Stats() Stats {
+	s := Stats{
+		Gets:       atomic.LoadInt64(&g.stats.gets),
+		Hits:       atomic.LoadInt64(&g.stats.hits),
+		Misses:     atomic.LoadInt64(&g.stats.misses),
+		PeerLoads:  atomic.LoadInt64(&g.stats.peerLoads),
+		PeerErrors: atomic.LoadInt64(&g.stats.peerErrors),
+		LocalLoads: atomic.LoadInt64(&g.stats.localLoads),
+		Dedups:     atomic.LoadInt64(&g.stats.dedups),
+	}
+	for _, c := range []store{g.mainCache, &g.hotCache} {
+		items, bytes, evictions := c.stats()
+		s.Items += items
+		s.Bytes += bytes
+		s.Evictions += evictions
+	}
+	return s
+}
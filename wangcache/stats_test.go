@@ -0,0 +1,122 @@
+package wangcache
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	group := NewGroup("stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("key [%s]: %w", key, ErrNotFound)
+	}))
+
+	group.Get("Tom")
+	group.Get("Tom")
+	if _, err := group.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, but got %v", err)
+	}
+
+	want := Stats{Gets: 3, Hits: 1, Misses: 2, LocalLoads: 2, Items: 1, Bytes: int64(len("Tom") + len(db["Tom"]))}
+	if s := group.Stats(); s != want {
+		t.Fatalf("expect %+v, but got %+v", want, s)
+	}
+}
+
+func TestStatsPeerLoads(t *testing.T) {
+	group := NewGroup("stats-peer", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	group.RegisterPeers(fakePicker{})
+
+	group.GetMulti([]string{"remote-a", "remote-b", "local"})
+	if s := group.Stats(); s.PeerLoads != 2 || s.LocalLoads != 1 || s.PeerErrors != 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestStatsEvictions(t *testing.T) {
+	// mainCache 可以使用 70 字节，每条记录 10 字节
+	group := NewGroup("stats-evict", 80, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value-"), nil
+	}))
+	for i := 0; i < 10; i++ {
+		group.Get("key" + strconv.Itoa(i))
+	}
+	if s := group.Stats(); s.Evictions != 3 || s.Items != 7 || s.Bytes != 70 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	// 主动删除的记录不计入 evictions
+	group.Remove("key9")
+	if s := group.Stats(); s.Evictions != 3 || s.Items != 6 {
+		t.Fatalf("unexpected stats after remove: %+v", s)
+	}
+}
+
+func TestStatsDedups(t *testing.T) {
+	release := make(chan struct{})
+	group := NewGroup("stats-dedup", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		<-release
+		return []byte("630"), nil
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			group.Get("Tom")
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if s := group.Stats(); s.LocalLoads != 1 || s.Dedups != 4 {
+		t.Fatalf("expect 1 load and 4 dedups, but got %+v", s)
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	r := NewRegistry()
+	group, _ := r.NewGroup(`metrics"group`, 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}))
+	group.Get("Tom")
+
+	pool := NewHTTPPool("http://self", WithRegistry(r))
+	srv := httptest.NewServer(pool)
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL + defaultBasePath + metricsPath)
+	if err != nil {
+		t.Fatalf("failed to get metrics, err: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected content type: %s", res.Header.Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"# TYPE wangcache_gets_total counter",
+		`wangcache_gets_total{group="metrics\"group"} 1`,
+		`wangcache_local_loads_total{group="metrics\"group"} 1`,
+		"# TYPE wangcache_items gauge",
+		`wangcache_items{group="metrics\"group"} 1`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("expect line %q in metrics:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package tinylfu
+
+import "hash/fnv"
+
+//Count-Min Sketch：用很小的内存近似统计每个key的访问频率
+//使用 depth 行计数器，每行用不同的哈希函数定位一个计数器，估算频率时取所有行中的最小值。
+//计数器达到上限后不再增加；总访问次数达到 sampleSize 时，所有计数器减半 (保鲜机制)，让频率统计能够反映最近的访问模式。
+
+const (
+	depth      = 4
+	maxCounter = 15 // 计数器上限，与4位计数器一致
+)
+
+type sketch struct {
+	rows       [depth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+// width 为每行计数器的个数，会向上取整为2的幂
+func newSketch(width int) *sketch {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{mask: uint64(w - 1), sampleSize: 10 * w}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+func hashKey(key string) (h1, h2 uint64) {
+	a := fnv.New64a()
+	a.Write([]byte(key))
+	b := fnv.New64()
+	b.Write([]byte(key))
+	return a.Sum64(), b.Sum64() | 1
+}
+
+// 记录一次访问
+func (s *sketch) increment(key string) {
+	h1, h2 := hashKey(key)
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][idx] < maxCounter {
+			s.rows[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+// 估算访问频率
+func (s *sketch) estimate(key string) uint8 {
+	h1, h2 := hashKey(key)
+	min := uint8(maxCounter)
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][idx] < min {
+			min = s.rows[i][idx]
+		}
+	}
+	return min
+}
+
+// 所有计数器减半
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,266 @@
+package tinylfu
+
+import (
+	"7go/wangCache/wangcache/policy"
+	"container/list"
+	"time"
+)
+
+//实现 W-TinyLFU 缓存淘汰算法 (Caffeine 使用的算法)
+
+//缓存分为两部分：
+//  - 窗口区 (window)：一个很小的LRU，约占 1% 的空间，新记录总是先进入这里，用于容纳突发的新访问
+//  - 主区 (main)：分段LRU (SLRU)，由试用区 (probation，约占主区 20%) 和保护区 (protected，约占主区 80%) 组成
+//从窗口区被挤出的记录作为候选者，与主区中即将被淘汰的记录(试用区队尾)比较 Count-Min Sketch 估算出的访问频率，
+//只有候选者的频率更高时才会被接纳进入主区，否则直接淘汰候选者。
+//试用区中的记录再次被访问时晋升到保护区，保护区满了之后把最久未访问的记录降级回试用区。
+
+const (
+	windowPercent    = 1  // 窗口区占总空间的百分比
+	protectedPercent = 80 // 保护区占主区的百分比
+)
+
+// 记录所在的区域
+const (
+	window = iota
+	probation
+	protected
+)
+
+// Cache is a W-TinyLFU cache. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes     int64 // 缓存允许使用的最大字节数
+	windowMax    int64 // 窗口区最大字节数
+	mainMax      int64 // 主区最大字节数
+	protectedMax int64 // 保护区最大字节数
+	lists        [3]*list.List
+	nbytes       [3]int64 // 各区域已使用的字节数
+	cache        map[string]*list.Element
+	sketch       *sketch
+	// optional and executed when an entry is purged.
+	// 某条记录被移除时的回调函数，可以为 nil
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time // 过期时间，零值表示永不过期
+	region int       // 所在区域
+}
+
+// 判断记录在 now 时刻是否已经过期
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+// Value use Len() to count how many bytes it takes
+type Value = policy.Value
+
+var _ policy.Cache = (*Cache)(nil)
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	c := &Cache{
+		maxBytes:  maxBytes,
+		windowMax: maxBytes * windowPercent / 100,
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+	c.mainMax = maxBytes - c.windowMax
+	c.protectedMax = c.mainMax * protectedPercent / 100
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+
+	// 按平均每条记录 64 字节估算计数器个数
+	width := int(maxBytes / 64)
+	if width < 256 {
+		width = 256
+	}
+	if width > 1<<20 {
+		width = 1 << 20
+	}
+	c.sketch = newSketch(width)
+	return c
+}
+
+// 获取缓存
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	c.sketch.increment(key)
+
+	ele, ok := c.cache[key]
+	if !ok {
+		return
+	}
+	e := ele.Value.(*entry)
+	if e.expired(time.Now()) {
+		c.evict(ele)
+		return nil, false
+	}
+	c.hit(ele)
+	return e.value, true
+}
+
+// 命中后调整记录的位置：试用区的记录晋升到保护区，其他区域的记录移动到队首
+func (c *Cache) hit(ele *list.Element) {
+	e := ele.Value.(*entry)
+	if e.region != probation {
+		c.lists[e.region].MoveToFront(ele)
+		return
+	}
+
+	c.move(ele, protected)
+	// 保护区满了，把最久未访问的记录降级回试用区
+	for c.nbytes[protected] > c.protectedMax {
+		c.move(c.lists[protected].Back(), probation)
+	}
+}
+
+// 将记录移动到指定区域的队首
+func (c *Cache) move(ele *list.Element, region int) *list.Element {
+	e := ele.Value.(*entry)
+	c.lists[e.region].Remove(ele)
+	c.nbytes[e.region] -= e.size()
+	e.region = region
+	ele = c.lists[region].PushFront(e)
+	c.nbytes[region] += e.size()
+	c.cache[e.key] = ele
+	return ele
+}
+
+// 移除指定的缓存
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.evict(ele)
+	}
+}
+
+// 清空所有缓存，每条记录都会触发回调函数；访问频率的统计会保留
+func (c *Cache) Purge() {
+	for _, l := range c.lists {
+		for ele := l.Back(); ele != nil; ele = l.Back() {
+			c.evict(ele)
+		}
+	}
+}
+
+// 移除所有已过期的记录，返回移除的数量
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, l := range c.lists {
+		for ele := l.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.evict(ele)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// 移除记录，并触发回调函数
+func (c *Cache) evict(ele *list.Element) {
+	e := ele.Value.(*entry)
+	c.lists[e.region].Remove(ele)
+	c.nbytes[e.region] -= e.size()
+	delete(c.cache, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// 新增/修改缓存，永不过期
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithTTL(key, value, 0)
+}
+
+// 新增/修改缓存，并设置过期时间；ttl <= 0 表示永不过期
+func (c *Cache) AddWithTTL(key string, value Value, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	c.sketch.increment(key)
+
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*entry)
+		c.nbytes[e.region] += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
+		e.expire = expire
+		c.hit(ele)
+	} else {
+		e := &entry{key: key, value: value, expire: expire, region: window}
+		c.cache[key] = c.lists[window].PushFront(e)
+		c.nbytes[window] += e.size()
+	}
+
+	if c.maxBytes != 0 {
+		c.evictWindow()
+		c.evictMain()
+	}
+}
+
+// 窗口区超出大小时，把被挤出的记录作为候选者尝试放入主区
+func (c *Cache) evictWindow() {
+	for c.nbytes[window] > c.windowMax {
+		candidate := c.move(c.lists[window].Back(), probation)
+		c.admit(candidate)
+	}
+}
+
+// 候选者已经放入试用区，主区放不下时，候选者与主区的淘汰者比较访问频率，频率低的一方被淘汰
+func (c *Cache) admit(candidate *list.Element) {
+	cand := candidate.Value.(*entry)
+	for c.nbytes[probation]+c.nbytes[protected] > c.mainMax {
+		victim := c.victim(candidate)
+		if victim == nil {
+			c.evict(candidate)
+			return
+		}
+		if c.sketch.estimate(cand.key) <= c.sketch.estimate(victim.Value.(*entry).key) {
+			c.evict(candidate)
+			return
+		}
+		c.evict(victim)
+	}
+}
+
+// 主区中下一个被淘汰的记录：优先选择试用区的队尾，其次是保护区的队尾，跳过候选者本身
+func (c *Cache) victim(candidate *list.Element) *list.Element {
+	for _, region := range []int{probation, protected} {
+		for ele := c.lists[region].Back(); ele != nil; ele = ele.Prev() {
+			if ele != candidate {
+				return ele
+			}
+		}
+	}
+	return nil
+}
+
+// 修改记录导致主区超出大小时，直接淘汰主区的记录
+func (c *Cache) evictMain() {
+	for c.nbytes[probation]+c.nbytes[protected] > c.mainMax {
+		victim := c.victim(nil)
+		if victim == nil {
+			return
+		}
+		c.evict(victim)
+	}
+}
+
+// Len the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// 当前已使用的字节数 (所有区域的总和)
+func (c *Cache) Bytes() int64 {
+	return c.nbytes[window] + c.nbytes[probation] + c.nbytes[protected]
+}
@@ -0,0 +1,103 @@
+package tinylfu
+
+import (
+	"reflect"
+	"testing"
+)
+
+type String string
+
+// 实现Value接口
+func (d String) Len() int {
+	return len(d)
+}
+
+// 测试添加和获取缓存
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("123"))
+
+	v, ok := lfu.Get("key1")
+	if !ok || string(v.(String)) != "123" {
+		t.Fatalf("cache hit key1=123 failed!")
+	}
+
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed!")
+	}
+}
+
+// 测试当使用内存超过了设定值时，只有访问频率更高的新记录才会被接纳
+func TestAdmission(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "key3"
+	v1, v2, v3 := "value1", "value2", "value3"
+
+	cap := len(k1 + v1 + k2 + v2)
+	lfu := New(int64(cap), nil)
+	lfu.Add(k1, String(v1))
+	lfu.Add(k2, String(v2))
+
+	// key3 的访问频率不比主区中的记录高，不会被接纳
+	lfu.Add(k3, String(v3))
+	if _, ok := lfu.Get(k3); ok || lfu.Len() != 2 {
+		t.Fatalf("key[%s] should not be admitted!", k3)
+	}
+
+	// key3 被频繁访问之后再添加，会淘汰掉 key1
+	lfu.Get(k3)
+	lfu.Get(k3)
+	lfu.Add(k3, String(v3))
+	if _, ok := lfu.Get(k3); !ok || lfu.Len() != 2 {
+		t.Fatalf("frequently used key[%s] should be admitted!", k3)
+	}
+	if _, ok := lfu.Get(k1); ok {
+		t.Fatalf("Remove key[%s] failed!", k1)
+	}
+}
+
+// 测试回调函数能否被调用
+func TestOnEvicted(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+
+	lfu := New(int64(10), callback)
+	lfu.Add("key1", String("123456"))
+	lfu.Add("k2", String("k2"))
+	lfu.Add("k3", String("k3"))
+	lfu.Add("k4", String("k4"))
+
+	// 新记录的访问频率都不比 key1 高，所以被淘汰的是新记录
+	expect := []string{"k2", "k3", "k4"}
+
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, but got keys is %s", expect, keys)
+	}
+}
+
+// 测试移除指定缓存和清空缓存
+func TestRemoveAndPurge(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+
+	lfu := New(int64(0), callback)
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Add("k3", String("v3"))
+
+	lfu.Remove("k2")
+	if _, ok := lfu.Get("k2"); ok || lfu.Len() != 2 {
+		t.Fatalf("Remove key[k2] failed!")
+	}
+
+	lfu.Purge()
+	if _, ok := lfu.Get("k1"); ok || lfu.Len() != 0 {
+		t.Fatalf("Purge failed!")
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expect OnEvicted to be called 3 times, but got %d", len(keys))
+	}
+}
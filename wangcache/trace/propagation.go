@@ -0,0 +1,87 @@
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+)
+
+// W3C Trace Context 的请求头，格式是 <version>-<trace-id>-<parent-id>-<trace-flags>，如:
+//
+//	traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+//
+// 见 https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "traceparent"
+
+const (
+	traceparentVersion = "00"
+	traceparentLen     = 55 // 版本 00 的长度
+	flagSampled        = 0x01
+)
+
+// 把 ctx 中的 span 信息写入请求头，发送请求前调用，ctx 中没有 span 时不做任何事
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	h.Set(TraceparentHeader, traceparentVersion+"-"+sc.TraceID.String()+"-"+sc.SpanID.String()+"-"+flags)
+}
+
+// 从请求头中解析出其他节点传递过来的 span 信息，返回带有该信息的 ctx
+// 请求头不存在或格式错误时原样返回 ctx，之后开始的 span 属于一条新的链路
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, ok := parseTraceparent(h.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+func parseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	// 更高的版本可能在后面追加字段，只解析与版本 00 相同的部分
+	if len(s) < traceparentLen || (len(s) > traceparentLen && s[traceparentLen] != '-') {
+		return sc, false
+	}
+	if s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, false
+	}
+	version, ok := parseHex(s[:2])
+	if !ok || version[0] == 0xff || (version[0] == 0 && len(s) != traceparentLen) {
+		return sc, false
+	}
+	traceID, ok := parseHex(s[3:35])
+	if !ok {
+		return sc, false
+	}
+	spanID, ok := parseHex(s[36:52])
+	if !ok {
+		return sc, false
+	}
+	flags, ok := parseHex(s[53:55])
+	if !ok {
+		return sc, false
+	}
+
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&flagSampled != 0
+	sc.Remote = true
+	return sc, sc.IsValid()
+}
+
+// 规范要求使用小写的十六进制
+func parseHex(s string) ([]byte, bool) {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
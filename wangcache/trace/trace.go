@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+)
+
+//分布式追踪：记录一次请求在各个节点上的每个阶段的耗时
+
+//与 OpenTelemetry 的模型兼容：TraceID/SpanID 的长度和格式相同，节点之间通过 W3C Trace Context 的 traceparent 请求头传递，
+//因此可以和使用 OpenTelemetry 的上下游服务串联成一条完整的链路。
+//本包只定义了最小的接口和一个简单的实现，接入 OpenTelemetry SDK 时，实现 Tracer 接口包装 otel 的 Tracer 即可
+
+// 一条链路的标识，同一个请求经过的所有节点上的 span 共享同一个 TraceID
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// 链路中一个 span 的标识
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// 需要在进程内和节点之间传递的 span 信息
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool // 是否采样，没有采样的 span 不会被导出
+	Remote  bool // 是否是从请求头中解析出来的 (由其他节点创建)
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Tracer 用来创建 span
+type Tracer interface {
+	// 开始一个新的 span，ctx 中有 span 时作为它的子 span，否则开始一条新的链路
+	// 返回的 ctx 中带有新的 span，用完后需要调用 Span.End
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span 表示链路中的一个阶段
+type Span interface {
+	SpanContext() SpanContext
+	// 设置属性，如 group、key、节点地址
+	SetAttribute(key string, value interface{})
+	// 记录该阶段发生的错误
+	RecordError(err error)
+	// 结束 span，之后的调用都会被忽略
+	End()
+}
+
+type spanContextKey struct{}
+
+// 返回带有 sc 的 ctx，之后在该 ctx 上开始的 span 都是 sc 的子 span
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// 返回 ctx 中的 span 信息，没有时返回零值
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Nop 不记录任何 span，但会保留 ctx 中已有的 span 信息，请求头中的链路仍然可以传递给下一个节点
+var Nop Tracer = nopTracer{}
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{sc: SpanContextFromContext(ctx)}
+}
+
+type nopSpan struct {
+	sc SpanContext
+}
+
+func (s nopSpan) SpanContext() SpanContext                 { return s.sc }
+func (nopSpan) SetAttribute(key string, value interface{}) {}
+func (nopSpan) RecordError(err error)                      {}
+func (nopSpan) End()                                       {}
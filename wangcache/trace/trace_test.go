@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestTraceparent(t *testing.T) {
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sc := SpanContextFromContext(Extract(context.Background(), h))
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled || !sc.Remote {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+
+	out := http.Header{}
+	Inject(ContextWithSpanContext(context.Background(), sc), out)
+	if out.Get(TraceparentHeader) != h.Get(TraceparentHeader) {
+		t.Fatalf("expect %s, but got %s", h.Get(TraceparentHeader), out.Get(TraceparentHeader))
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		h.Set(TraceparentHeader, bad)
+		if sc := SpanContextFromContext(Extract(context.Background(), h)); sc.IsValid() {
+			t.Fatalf("expect %q to be rejected, but got %+v", bad, sc)
+		}
+	}
+
+	// 更高的版本可以在后面追加字段
+	h.Set(TraceparentHeader, "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+	if sc := SpanContextFromContext(Extract(context.Background(), h)); !sc.IsValid() || sc.Sampled {
+		t.Fatalf("unexpected span context %+v", sc)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter)
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttribute("key", "Tom")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	child.End()
+	root.End()
+
+	spans := exporter.Spans()
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "root" {
+		t.Fatalf("expect child and root spans, but got %+v", spans)
+	}
+	if spans[0].SpanContext.TraceID != spans[1].SpanContext.TraceID || spans[0].Parent != spans[1].SpanContext {
+		t.Fatalf("expect child to be in the trace of root, but got %+v", spans)
+	}
+	if spans[1].Parent.IsValid() {
+		t.Fatalf("expect root to have no parent, but got %+v", spans[1].Parent)
+	}
+	if spans[0].Attributes["key"] != "Tom" || spans[0].Err == nil || spans[0].End.Before(spans[0].Start) {
+		t.Fatalf("unexpected child span %+v", spans[0])
+	}
+
+	// 其他节点没有采样的链路不导出
+	exporter.Reset()
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, span := tracer.Start(Extract(context.Background(), h), "remote")
+	span.End()
+	if sc := SpanContextFromContext(ctx); sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.Sampled {
+		t.Fatalf("expect span to join the remote trace, but got %+v", sc)
+	}
+	if spans := exporter.Spans(); len(spans) != 0 {
+		t.Fatalf("expect unsampled span not to be exported, but got %+v", spans)
+	}
+}
+
+func TestNop(t *testing.T) {
+	sc := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}, Sampled: true}
+	ctx, span := Nop.Start(ContextWithSpanContext(context.Background(), sc), "nop")
+	span.End()
+	if SpanContextFromContext(ctx) != sc || span.SpanContext() != sc {
+		t.Fatalf("expect nop tracer to keep the span context")
+	}
+}
@@ -0,0 +1,156 @@
+package trace
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 一个已经结束的 span 的所有数据，交给 Exporter 导出
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext // 父 span，开始一条新的链路时为零值
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]interface{}
+	Err         error // 最后一次记录的错误
+}
+
+// Exporter 接收结束的 span，比如输出到日志或发送给追踪系统
+// 会被多个 goroutine 同时调用
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// 新建一个 Tracer，所有采样的 span 结束后交给 exporter
+// 新的链路总是采样，子 span 沿用父 span (包括其他节点传递过来的) 的采样结果
+func NewTracer(exporter Exporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter Exporter
+}
+
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{SpanID: newSpanID(), Sampled: true}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		parent = SpanContext{}
+		sc.TraceID = newTraceID()
+	}
+
+	s := &span{
+		exporter: t.exporter,
+		data: SpanData{
+			Name:        name,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpanContext(ctx, sc), s
+}
+
+type span struct {
+	exporter Exporter
+	mu       sync.Mutex
+	data     SpanData
+	ended    bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+func (s *span) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.ended && err != nil {
+		s.data.Err = err
+	}
+}
+
+func (s *span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.mu.Unlock()
+
+	if s.data.SpanContext.Sampled && s.exporter != nil {
+		s.exporter.Export(s.data)
+	}
+}
+
+// 随机生成的ID，全为0的ID是无效的
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		binary.BigEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return
+}
+
+// InMemoryExporter 把结束的 span 保存在内存中，用于测试
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, span)
+}
+
+// 返回所有已经结束的 span，按结束的顺序排列
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]SpanData(nil), e.spans...)
+}
+
+// 清空保存的 span
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = nil
+}
@@ -0,0 +1,22 @@
+package wangcache
+
+import "7go/wangCache/wangcache/trace"
+
+//分布式追踪：通过 WithTracer 开启后，一次 Get 在每个节点上记录以下 span，
+//远程节点上的 span 通过 traceparent 请求头串联到调用方的 wangcache.peer 下面
+
+const (
+	spanGet          = "wangcache.Get"          // 整个请求
+	spanLookup       = "wangcache.lookup"       // 在本地缓存中查找
+	spanSingleflight = "wangcache.singleflight" // 等待同一个key的加载 (包括合并到其他请求上的等待)
+	spanPeer         = "wangcache.peer"         // 访问远程节点
+	spanGetter       = "wangcache.getter"       // 调用 Getter 回源查询
+)
+
+// 结束 span，err 不为 nil 时记录到 span 上
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
@@ -0,0 +1,77 @@
+package wangcache
+
+import (
+	"7go/wangCache/wangcache/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// 按名称查找 span
+func findSpan(t *testing.T, spans []trace.SpanData, name string) trace.SpanData {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("expect span %s, but got %+v", name, spans)
+	return trace.SpanData{}
+}
+
+func TestTracing(t *testing.T) {
+	// 节点a没有数据，所有key都由节点b负责
+	var b *HTTPPool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	exporters := []*trace.InMemoryExporter{trace.NewInMemoryExporter(), trace.NewInMemoryExporter()}
+	registries := []*Registry{NewRegistry(), NewRegistry()}
+	a := NewHTTPPool("http://node-a", WithRegistry(registries[0]))
+	b = NewHTTPPool(srv.URL, WithRegistry(registries[1]))
+	for i, pool := range []*HTTPPool{a, b} {
+		pool.Set(srv.URL)
+		registries[i].RegisterPeers(pool)
+		registries[i].NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(db[key]), nil
+		}), WithTracer(trace.NewTracer(exporters[i])))
+	}
+
+	if view, err := registries[0].GetGroup("scores").Get("Tom"); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("expect %s, but got %q, err: %v", db["Tom"], view, err)
+	}
+
+	// 节点a: Get -> lookup, Get -> singleflight -> peer
+	spans := exporters[0].Spans()
+	get := findSpan(t, spans, spanGet)
+	lookup := findSpan(t, spans, spanLookup)
+	wait := findSpan(t, spans, spanSingleflight)
+	peer := findSpan(t, spans, spanPeer)
+	if get.Parent.IsValid() || get.Attributes["wangcache.key"] != "Tom" || get.Attributes["wangcache.group"] != "scores" {
+		t.Fatalf("unexpected root span %+v", get)
+	}
+	if lookup.Parent != get.SpanContext || lookup.Attributes["wangcache.hit"] != false {
+		t.Fatalf("unexpected lookup span %+v", lookup)
+	}
+	if wait.Parent != get.SpanContext || peer.Parent != wait.SpanContext || peer.Attributes["wangcache.peer"] != srv.URL {
+		t.Fatalf("unexpected peer spans %+v, %+v", wait, peer)
+	}
+
+	// 节点b: 通过请求头串联到节点a的 peer 下面，Get -> singleflight -> getter
+	spans = exporters[1].Spans()
+	remote := findSpan(t, spans, spanGet)
+	getter := findSpan(t, spans, spanGetter)
+	if remote.Parent.TraceID != get.SpanContext.TraceID || remote.Parent.SpanID != peer.SpanContext.SpanID || !remote.Parent.Remote {
+		t.Fatalf("expect span on peer to be a child of %+v, but got %+v", peer.SpanContext, remote.Parent)
+	}
+	if getter.SpanContext.TraceID != get.SpanContext.TraceID || getter.Parent != findSpan(t, spans, spanSingleflight).SpanContext {
+		t.Fatalf("unexpected getter span %+v", getter)
+	}
+	for _, span := range spans {
+		if span.Name == spanPeer {
+			t.Fatalf("expect node b to load locally, but got %+v", span)
+		}
+	}
+}
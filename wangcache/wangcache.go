@@ -1,10 +1,16 @@
 package wangcache
 
 import (
+	"7go/wangCache/wangcache/logger"
 	"7go/wangCache/wangcache/singleflight"
+	"7go/wangCache/wangcache/trace"
+	pb "7go/wangCache/wangcache/wangcachepb"
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"sync"
+	"math/rand"
+	"sync/atomic"
+	"time"
 )
 
 //负责与外部交互，控制缓存存储和获取的主流程
@@ -22,6 +28,10 @@ type Getter interface {
 	Get(key string) ([]byte, error)  // 通过指定的key获取数据
 }
 
+// Getter 在数据源中查不到key时应返回 ErrNotFound (或使用 %w 包装它的错误)，
+// 这样 Group 才能区分"数据不存在"与"查询出错"，并对不存在的key进行负缓存，避免缓存穿透
+var ErrNotFound = errors.New("wangcache: key not found")
+
 // 自定义一个函数类型
 type GetterFunc func(key string) ([]byte, error)
 
@@ -30,87 +40,326 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// Getter 的 context 版本，Getter 同时实现了 ContextGetter 时 Group 优先使用它
+// 调用方取消请求或者超时 (见 WithTimeout) 后，ctx 随之取消，回调应当尽快放弃正在进行的查询
+type ContextGetter interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// 支持 context 的函数类型，同时实现了 Getter 和 ContextGetter 接口
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// Getter 同时实现了 BatchGetter 时，Group 会把短时间内并发未命中的多个key合并成一次 GetMulti 调用，
+// 比如用一条 SELECT ... WHERE id IN (...) 代替多条查询
+// 返回的map中不存在的key视为 ErrNotFound；返回 error 时这一批的所有key都以该错误失败
+type BatchGetter interface {
+	GetMulti(keys []string) (map[string][]byte, error)
+}
+
+// 批量获取源数据的函数类型，同时实现了 Getter 和 BatchGetter 接口
+type BatchGetterFunc func(keys []string) (map[string][]byte, error)
+
+func (f BatchGetterFunc) GetMulti(keys []string) (map[string][]byte, error) {
+	return f(keys)
+}
+
+func (f BatchGetterFunc) Get(key string) ([]byte, error) {
+	values, err := f([]string{key})
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := values[key]; ok {
+		return value, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+}
+
+
+// hotCache 相关的参数，参考 groupcache 的实现
+const (
+	hotCacheRatio = 8   // hotCache 占用 cacheBytes 的 1/8
+	hotCacheOdds  = 10  // 从远程节点获取到的值，有 1/10 的概率保存到 hotCache
+)
 
 // Group是 wangCache最核心的数据结构，负责与用户的交互，并且控制缓存值存储和获取的流程
 type Group struct {
 	name      string  // 缓存的命名空间 (缓存的分类)
 	getter    Getter  // 缓存未命中时获取源数据的回调(callback)
-	mainCache cache
+	mainCache store
+	// hotCache 保存从远程节点获取到的值 (这些key由其他节点负责)，
+	// 避免热点key的每次请求都要经过网络访问同一个节点
+	hotCache  cache
+	hotOdds   int  // 远程获取到的值有 1/hotOdds 的概率保存到 hotCache
 	peers     PeerPicker
+	inherited bool  // peers 是否由 Registry 自动注册，这时仍然可以通过 RegisterPeers 替换
 	// use singleflight.Group to make sure that each key is only fetched once
 	loader *singleflight.Group
+	ttl       time.Duration  // 缓存值的默认过期时间，0 表示永不过期
+	ttlJitter time.Duration  // 过期时间的随机抖动范围
+	negCache  cache          // 负缓存，记录数据源中不存在的key
+	negTTL    time.Duration  // 负缓存的过期时间，0 表示不开启负缓存
+	filter    *keyFilter     // 布隆过滤器，为 nil 表示不开启
+	cacheBytes int64          // 主缓存最大使用内存字节数
+	policy     EvictionPolicy // 主缓存的淘汰策略
+	shards     int            // 主缓存的分片数量，<= 1 表示不分片
+	broadcast  bool           // 写操作后是否广播通知所有节点丢弃 hotCache 中的副本
+	replicas     int  // 每个key的副本数量 (包括主节点)，<= 1 表示不开启多副本
+	writeThrough bool // 从数据源加载后是否写入其他副本节点
+	batchWindow time.Duration  // 合并未命中key的时间窗口，<= 0 表示不合并
+	batchSize   int            // 每次批量获取的最大key数量
+	batcher     *batchLoader   // getter 实现了 BatchGetter 时不为 nil
+	timeout     time.Duration  // 缓存未命中时加载的超时时间，0 表示不限制
+	stats       groupStats     // 统计数据，见 Stats
+	logger      logger.Logger  // 默认不输出日志
+	tracer      trace.Tracer   // 默认不记录 span
 }
 
-var (
-	mu sync.RWMutex
-	groups = make(map[string]*Group)  // 保存着所有的缓存实例，key是对应缓存的命名空间name
-)
+// 新建一个缓存实例，注册到默认的 Registry 中
+// 与 Registry.NewGroup 不同，同名的Group已经存在时会被替换
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
+	g := newGroup(name, cacheBytes, getter, opts...)
+	DefaultRegistry.replace(g)
+	return g
+}
 
-// 新建一个缓存实例
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// 获取默认 Registry 中指定name的Group实例
+func GetGroup(name string) *Group {
+	return DefaultRegistry.GetGroup(name)
+}
+
+// 从默认的 Registry 中删除指定name的Group，见 Registry.DeleteGroup
+func DeleteGroup(name string) bool {
+	return DefaultRegistry.DeleteGroup(name)
+}
+
+// 创建Group并启动后台的清理goroutine，不注册到任何 Registry
+func newGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
-
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:       name,
+		getter:     getter,
+		loader:     &singleflight.Group{},
+		cacheBytes: cacheBytes,
+		hotOdds:    hotCacheOdds,
+		batchWindow: defaultBatchWindow,
+		batchSize:   defaultBatchSize,
+		logger:      logger.Nop,
+		tracer:      trace.Nop,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if bg, ok := getter.(BatchGetter); ok && g.batchWindow > 0 {
+		g.batcher = &batchLoader{getter: bg, window: g.batchWindow, size: g.batchSize}
+	}
+	// hotCache 的内存从 cacheBytes 中划分出来，两者的总和不超过 cacheBytes
+	// cacheBytes 太小时 hotBytes 为0，会被当作不限制，这时不使用 hotCache
+	hotBytes := g.cacheBytes / hotCacheRatio
+	g.mainCache = newStore(g.cacheBytes-hotBytes, g.policy, g.shards)
+	g.hotCache = cache{cacheBytes: hotBytes, policy: g.policy, disabled: g.cacheBytes > 0 && hotBytes == 0}
+	if g.ttl > 0 {
+		g.mainCache.startReaper(g.reapInterval())
+		g.hotCache.startReaper(g.reapInterval())
+	}
+	if g.negTTL > 0 {
+		g.negCache.startReaper(g.negTTL)
 	}
-	groups[name] = g
 	return g
 }
 
-// 获取指定name的Group实例
-func GetGroup(name string) *Group {
-	mu.RLock()
-	defer mu.RUnlock()
-	g := groups[name]
-	return g
+// 停止Group的后台清理goroutine，在Group被替换或删除时调用
+func (g *Group) stop() {
+	g.mainCache.stopReaper()
+	g.hotCache.stopReaper()
+	g.negCache.stopReaper()
+}
+
+// 返回Group的名称
+func (g *Group) Name() string {
+	return g.name
 }
 
 // 从当前group中获取缓存数据
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 从当前group中获取缓存数据，ctx 被取消或超时后，正在进行的远程请求和回源查询也会被取消
+// (只实现了旧接口的 PeerGetter/Getter 无法被中途取消)
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	return g.get(ctx, key, true)
+}
+
+// GetLocalContext 与 GetContext 相同，但未命中的key直接在当前节点加载，不再路由到其他节点
+// 用于处理其他节点转发过来的请求 (HTTPPool 之外的 PeerPicker，如 grpcpool)，
+// 避免各节点的哈希环不一致时请求在节点之间被来回转发
+func (g *Group) GetLocalContext(ctx context.Context, key string) (ByteView, error) {
+	return g.get(ctx, key, false)
+}
+
+// route 为 false 时 (其他节点转发过来的请求) 未命中的key直接在本地加载，不再路由到其他节点
+func (g *Group) get(ctx context.Context, key string, route bool) (value ByteView, err error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
-	val, ok := g.mainCache.get(key)
+	ctx, span := g.tracer.Start(ctx, spanGet)
+	span.SetAttribute("wangcache.group", g.name)
+	span.SetAttribute("wangcache.key", key)
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	_, lookup := g.tracer.Start(ctx, spanLookup)
+	val, ok, err := g.lookupCache(key)
+	lookup.SetAttribute("wangcache.hit", ok)
+	lookup.End()
 	if ok {
-		log.Printf("[Server %s] key [%s] cache hit\n", g.peers.(*HTTPPool).self, key)
-		return val, nil
+		return val, err
 	}
-	log.Printf("[Server %s] local cache is missed, now go to load data for key[%s]", g.peers.(*HTTPPool).self, key)
-	return g.load(key)
+	g.logger.Debug("cache miss", "group", g.name, "self", g.self(), "key", key)
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+	return g.load(ctx, key, route)
 }
 
+// 在当前节点的缓存中查找key，ok 为 true 表示不需要再加载：
+// 命中缓存时返回缓存值，已知key不存在 (负缓存或布隆过滤器) 时返回 ErrNotFound
+// 每次调用都计为一次获取请求，并根据结果记录命中或未命中
+func (g *Group) lookupCache(key string) (value ByteView, ok bool, err error) {
+	atomic.AddInt64(&g.stats.gets, 1)
+	defer func() {
+		if ok {
+			atomic.AddInt64(&g.stats.hits, 1)
+		} else {
+			atomic.AddInt64(&g.stats.misses, 1)
+		}
+	}()
+
+	if val, ok := g.mainCache.get(key); ok {
+		g.logger.Debug("cache hit", "group", g.name, "self", g.self(), "key", key)
+		return val, true, nil
+	}
+	if val, ok := g.hotCache.get(key); ok {
+		g.logger.Debug("hot cache hit", "group", g.name, "self", g.self(), "key", key)
+		return val, true, nil
+	}
+	if g.negTTL > 0 {
+		if _, ok := g.negCache.get(key); ok {
+			g.logger.Debug("negative cache hit", "group", g.name, "self", g.self(), "key", key)
+			return ByteView{}, true, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+	}
+	if g.filter != nil && !g.filter.mayContain(key) {
+		g.logger.Debug("rejected by bloom filter", "group", g.name, "self", g.self(), "key", key)
+		return ByteView{}, true, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	return ByteView{}, false, nil
+}
+
+// 节点在日志中的名称，PeerGetter 实现了 fmt.Stringer 时为节点的地址
+func peerName(peer PeerGetter) string {
+	if s, ok := peer.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", peer)
+}
+
+// 当前节点的标识，作为日志中的 self 字段
+// PeerPicker 实现了 SelfIdentifier 时返回它的地址，没有注册 PeerPicker 时为单机模式
+func (g *Group) self() string {
+	if id, ok := g.peers.(SelfIdentifier); ok {
+		return id.Self()
+	}
+	if g.peers == nil {
+		return "standalone"
+	}
+	return "unknown"
+}
+
+// 注册选择远程节点的 PeerPicker，可以是 HTTPPool、grpcpool.GRPCPool 或者任何自定义实现
+// 不注册时 Group 工作在单机模式下，所有未命中的key都由本地的 Getter 加载
+// 只能调用一次；Registry 自动注册的 PeerPicker 不算在内，会被这里传入的 peers 替换
 func (g *Group) RegisterPeers(peers PeerPicker) {
-	if g.peers != nil {
+	if g.peers != nil && !g.inherited {
 		panic("RegisterPeerPicker called more than once")
 	}
 	g.peers = peers
+	g.inherited = false
+}
+
+// 注册 Registry 中的 PeerPicker，已经注册过 PeerPicker 的group保持不变
+func (g *Group) inheritPeers(peers PeerPicker) {
+	if g.peers == nil {
+		g.peers = peers
+		g.inherited = true
+	}
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
+// route 为 false 时不访问其他节点，直接在本地加载
+// 加载到的数据只有在当前节点真正负责该key时才保存到 mainCache，
+// 按负载临时选择了当前节点时只保存到 hotCache，避免写操作路由到负责该key的节点后，这里仍然保留着旧值
+func (g *Group) load(ctx context.Context, key string, route bool) (value ByteView, err error) {
 	//将原来的 load相关逻辑，使用 g.loader.Do包裹起来，这样确保了并发场景下针对相同的 key，load过程只会调用一次
 	// 不管是远程调用获取还是本地获取，并发场景下，每个key都只会获取缓存值一次
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			// 根据key选择节点
-			if peer, ok := g.peers.PickPeer(key); ok {
-				// 分布式场景下会调用 getFromPeer从其他远程节点获取缓存值
-				if value, err := g.getFromPeer(peer, key); err == nil {
-					return value, nil
-				}
-				log.Printf("[wangCache] failed to get key[%s] from peer, error: %v", key, err)
+	// 等待中的请求被取消后立即返回，共享的加载只有在所有等待该key的请求都离开后才会被取消
+	var called int32  // fn 是否由当前请求发起，用于统计被合并的请求
+	ctx, wait := g.tracer.Start(ctx, spanSingleflight)
+	viewi, err, shared := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		atomic.StoreInt32(&called, 1)
+		// 根据key选择节点，开启多副本时依次尝试排在当前节点之前的主节点和副本节点
+		var before []PeerGetter
+		if route {
+			peers, self := g.pickReplicas(key)
+			before = peers
+			if self >= 0 {
+				before = peers[:self]
+			}
+		}
+		for _, peer := range before {
+			// 分布式场景下会调用 getFromPeer从其他远程节点获取缓存值
+			value, err := g.getFromPeer(ctx, peer, key)
+			if err == nil {
+				atomic.AddInt64(&g.stats.peerLoads, 1)
+				return value, nil
+			}
+			// 远程节点已经确认数据源中不存在该key，无需再回源查询
+			if errors.Is(err, ErrNotFound) {
+				atomic.AddInt64(&g.stats.peerLoads, 1)
+				g.populateNegative(key)
+				return nil, err
+			}
+			atomic.AddInt64(&g.stats.peerErrors, 1)
+			// 调用方已经取消或超时，不再尝试其他节点和数据源
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
 			}
+			g.logger.Warn("failed to get key from peer", "group", g.name, "self", g.self(), "key", key, "peer", peerName(peer), "error", err)
 		}
 		// 如果远程节点取不到缓存值或者目标节点就是本机节点，则直接从本地获取 (一般是从数据库中查询获取数据)
-		return g.getLocally(key)
+		owners, self := g.pickOwners(key)
+		value, err := g.getLocally(ctx, key, self >= 0)
+		if err == nil && self >= 0 && g.writeThrough {
+			// 当前节点负责该key，把加载到的数据写入排在自己之后的副本节点
+			g.replicate(key, value, owners[self:])
+		}
+		return value, err
 	})
+	if shared && atomic.LoadInt32(&called) == 0 {
+		atomic.AddInt64(&g.stats.dedups, 1)
+	}
+	wait.SetAttribute("wangcache.shared", shared)
+	endSpan(wait, err)
 
 	if err == nil {
 		// viewi 是interface{}类型的，所以需要转类型
@@ -120,33 +369,131 @@ func (g *Group) load(key string) (value ByteView, err error) {
 }
 
 // 访问远程节点，获取缓存值
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	log.Printf("=====fetch data from remote node is starting====")
-	data, err := peer.Get(g.name, key)
-	log.Printf("=====fetch data from remote node is end====")
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	ctx, span := g.tracer.Start(ctx, spanPeer)
+	span.SetAttribute("wangcache.peer", peerName(peer))
+	start := time.Now()
+	value, err := g.fetchFromPeer(ctx, peer, key)
+	g.logger.Debug("fetch from peer", "group", g.name, "self", g.self(), "key", key, "peer", peerName(peer), "latency", time.Since(start), "error", err)
+	endSpan(span, err)
+	if err != nil {
+		return ByteView{}, err
+	}
+	g.populatePeerValue(key, value)
+	return value, nil
+}
+
+// 记录从远程节点获取到的缓存值
+func (g *Group) populatePeerValue(key string, value ByteView) {
+	if g.filter != nil {
+		g.filter.add(key)
+	}
+	// 这个key由其他节点负责，不保存到 mainCache；
+	// 但对于热点key，有一定概率在本节点的 hotCache 中也保存一份，增加热点数据的吞吐量
+	if rand.Intn(g.hotOdds) == 0 {
+		g.hotCache.add(key, value)
+	}
+}
+
+// 优先通过 PeerFetcher 获取带有过期时间的缓存值，远程节点的过期时间与本地默认过期时间取较早的一个
+// 节点实现了 context 版本的接口时优先使用，调用方取消后请求随之取消
+func (g *Group) fetchFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	in := &pb.Request{Version: pb.Version, Group: g.name, Key: key}
+	out := new(pb.Response)
+	var err error
+	switch p := peer.(type) {
+	case ContextPeerFetcher:
+		err = p.FetchContext(ctx, in, out)
+	case PeerFetcher:
+		err = p.Fetch(in, out)
+	default:
+		var data []byte
+		if getter, ok := peer.(ContextPeerGetter); ok {
+			data, err = getter.GetContext(ctx, g.name, key)
+		} else {
+			data, err = peer.Get(g.name, key)
+		}
+		if err != nil {
+			return ByteView{}, err
+		}
+		return ByteView{b: data, e: g.expireAt()}, nil
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: data}, nil
+	return g.viewFromResponse(out), nil
+}
+
+// 根据远程节点的响应构造缓存值，过期时间取远程节点剩余的过期时间与本地默认过期时间中较早的一个
+func (g *Group) viewFromResponse(out *pb.Response) ByteView {
+	value := ByteView{b: out.Value, e: g.expireAt()}
+	if out.Ttl > 0 {
+		e := time.Now().Add(time.Duration(out.Ttl) * time.Millisecond)
+		if value.e.IsZero() || e.Before(value.e) {
+			value.e = e
+		}
+	}
+	return value
 }
 
 // getLocally 调用用户回调函数 g.getter.Get()获取源数据
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+// getter 实现了 BatchGetter 时，与同一时间窗口内的其他key一起批量获取
+// owned 为 false 时当前节点不负责该key，数据只保存到 hotCache
+func (g *Group) getLocally(ctx context.Context, key string, owned bool) (ByteView, error) {
+	atomic.AddInt64(&g.stats.localLoads, 1)
+	ctx, span := g.tracer.Start(ctx, spanGetter)
+	start := time.Now()
+	var bytes []byte
+	var err error
+	if g.batcher != nil {
+		bytes, err = g.batcher.get(ctx, key)
+	} else {
+		bytes, err = g.getSource(ctx, key)
+	}
+	g.logger.Debug("load from getter", "group", g.name, "self", g.self(), "key", key, "latency", time.Since(start), "error", err)
+	endSpan(span, err)
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			g.populateNegative(key)
+		}
 		return ByteView{}, err
 	}
 
-	value := ByteView{b: cloneBytes(bytes)}
-	g.populateCache(key, value)
+	value := ByteView{b: cloneBytes(bytes), e: g.expireAt()}
+	if g.filter != nil {
+		g.filter.add(key)
+	}
+	if owned {
+		g.populateCache(key, value)
+	} else {
+		g.hotCache.add(key, value)
+	}
 	return value, nil
 }
 
+// 优先调用 ContextGetter，只实现了 Getter 的回调一旦开始就无法取消
+func (g *Group) getSource(ctx context.Context, key string) ([]byte, error) {
+	if getter, ok := g.getter.(ContextGetter); ok {
+		return getter.GetContext(ctx, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return g.getter.Get(key)
+}
+
 // 将源数据添加到缓存中
 func (g *Group) populateCache(key string, value ByteView) {
 	g.mainCache.add(key, value)
 }
 
+// 将数据源中不存在的key记录到负缓存中，在 negTTL 时间内不再回源查询
+func (g *Group) populateNegative(key string) {
+	if g.negTTL > 0 {
+		g.negCache.add(key, ByteView{e: time.Now().Add(g.negTTL)})
+	}
+}
+
 
 
 
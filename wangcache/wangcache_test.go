@@ -1,10 +1,15 @@
 package wangcache
 
 import (
+	"7go/wangCache/wangcache/logger"
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // 模拟数据库
@@ -79,3 +84,224 @@ func TestGetGroup(t *testing.T) {
 		t.Fatalf("expect nil, but got %s", group2.name)
 	}
 }
+
+// 不依赖 HTTPPool 的 PeerPicker，"remote-" 开头的key由远程节点负责
+type fakePicker struct{}
+
+func (fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote-") {
+		return fakePeer{}, true
+	}
+	return nil, false
+}
+
+type fakePeer struct{}
+
+func (fakePeer) Get(group string, key string) ([]byte, error) {
+	return []byte("peer:" + key), nil
+}
+
+func TestCustomPeerPicker(t *testing.T) {
+	group := NewGroup("scores-custom-picker", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local:" + key), nil
+	}))
+	group.RegisterPeers(fakePicker{})
+
+	if view, err := group.Get("remote-Tom"); err != nil || view.String() != "peer:remote-Tom" {
+		t.Fatalf("expect remote-Tom from peer, but got %q, err: %v", view, err)
+	}
+	if view, err := group.Get("Tom"); err != nil || view.String() != "local:Tom" {
+		t.Fatalf("expect Tom to be loaded locally, but got %q, err: %v", view, err)
+	}
+	if group.self() != "unknown" {
+		t.Fatalf("expect unknown identity for picker without Self, but got %s", group.self())
+	}
+}
+
+func TestGetWithTTL(t *testing.T) {
+	loads := 0
+	group := NewGroup("scores-ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	}), WithTTL(20*time.Millisecond, 10*time.Millisecond))
+
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001")
+	group.RegisterPeers(pool)
+
+	for i := 0; i < 2; i++ {
+		if view, err := group.Get("Tom"); err != nil || view.String() != db["Tom"] {
+			t.Fatalf("failed to get value of Tom")
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect 1 load before expire, but got %d", loads)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	if view, err := group.Get("Tom"); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("failed to get value of Tom")
+	}
+	if loads != 2 {
+		t.Fatalf("expect Tom to be reloaded after expire, but got %d loads", loads)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loads := 0
+	group := NewGroup("scores-negative", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("key [%s]: %w", key, ErrNotFound)
+	}), WithNegativeCache(20*time.Millisecond, 1<<10))
+
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001")
+	group.RegisterPeers(pool)
+
+	for i := 0; i < 3; i++ {
+		if _, err := group.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, but got %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expect unknown to be loaded once, but got %d loads", loads)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	if _, err := group.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, but got %v", err)
+	}
+	if loads != 2 {
+		t.Fatalf("expect unknown to be reloaded after negative ttl, but got %d loads", loads)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	loads := 0
+	group := NewGroup("scores-bloom", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("key [%s]: %w", key, ErrNotFound)
+	}), WithBloomFilter(100, 0.01))
+
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001")
+	group.RegisterPeers(pool)
+
+	keys := make([]string, 0, len(db))
+	for k := range db {
+		keys = append(keys, k)
+	}
+	n, err := group.SeedBloomFilter(func() (string, bool) {
+		if len(keys) == 0 {
+			return "", false
+		}
+		key := keys[0]
+		keys = keys[1:]
+		return key, true
+	})
+	if err != nil || n != len(db) {
+		t.Fatalf("expect %d keys seeded, but got %d, err: %v", len(db), n, err)
+	}
+
+	if view, err := group.Get("Tom"); err != nil || view.String() != db["Tom"] {
+		t.Fatalf("failed to get value of Tom")
+	}
+	if _, err := group.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expect ErrNotFound, but got %v", err)
+	}
+	if loads != 1 {
+		t.Fatalf("expect unknown to be rejected without loading, but got %d loads", loads)
+	}
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001")
+
+	for _, p := range []EvictionPolicy{LRU, LFU, FIFO, ARC, TinyLFU} {
+		loads := 0
+		group := NewGroup(fmt.Sprintf("scores-policy-%d", p), 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			loads++
+			return []byte(db[key]), nil
+		}), WithEvictionPolicy(p))
+		group.RegisterPeers(pool)
+
+		for k, v := range db {
+			for i := 0; i < 2; i++ {
+				if view, err := group.Get(k); err != nil || view.String() != v {
+					t.Fatalf("policy %d: failed to get value of %s", p, k)
+				}
+			}
+		}
+		if loads != len(db) {
+			t.Fatalf("policy %d: expect %d loads, but got %d", p, len(db), loads)
+		}
+	}
+}
+
+func TestSetAndRemove(t *testing.T) {
+	loads := 0
+	group := NewGroup("scores-set", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	}))
+
+	pool := NewHTTPPool("http://localhost:8001")
+	pool.Set("http://localhost:8001")
+	group.RegisterPeers(pool)
+
+	if err := group.Set("Tom", []byte("700")); err != nil {
+		t.Fatalf("failed to set Tom, err: %v", err)
+	}
+	if view, err := group.Get("Tom"); err != nil || view.String() != "700" || loads != 0 {
+		t.Fatalf("expect Tom=700 without loading, but got %s, %d loads", view, loads)
+	}
+
+	if err := group.Remove("Tom"); err != nil {
+		t.Fatalf("failed to remove Tom, err: %v", err)
+	}
+	if view, err := group.Get("Tom"); err != nil || view.String() != db["Tom"] || loads != 1 {
+		t.Fatalf("expect Tom to be reloaded after remove, but got %s, %d loads", view, loads)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logs := logger.Std(log.New(&buf, "", 0), logger.LevelDebug)
+	group := NewGroup("scores-log", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), WithLogger(logs))
+
+	pool := NewHTTPPool("http://localhost:8001", WithPoolLogger(logs))
+	// 哈希环上只有一个远程节点，所有key都由它负责
+	pool.Set("http://localhost:8002")
+	if _, ok := pool.PickPeer("Tom"); !ok {
+		t.Fatal("expect Tom to be picked from peer")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := group.Get("Sam"); err != nil {
+			t.Fatalf("failed to get Sam, err: %v", err)
+		}
+	}
+
+	out := buf.String()
+	for _, expect := range []string{
+		"DEBUG select node key=Tom node=http://localhost:8002",
+		"DEBUG pick peer key=Tom peer=http://localhost:8002",
+		"DEBUG cache miss group=scores-log self=standalone key=Sam",
+		"DEBUG load from getter group=scores-log self=standalone key=Sam latency=",
+		"DEBUG cache hit group=scores-log self=standalone key=Sam",
+	} {
+		if !strings.Contains(out, expect) {
+			t.Fatalf("expect log %q, but got:\n%s", expect, out)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package wangcachepb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+//手写的 protobuf 二进制编解码，只使用消息的导出字段，生成的类型和 types_nogen.go 中的类型都可以使用
+//默认构建时只在测试中与 google.golang.org/protobuf 的编码结果对比，使用 -tags wangcachepb_nogen 构建时作为消息的编解码实现
+
+func marshalRequest(m *Request) []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(m.Version))
+	b = appendBytesField(b, 2, []byte(m.Group))
+	b = appendBytesField(b, 3, []byte(m.Key))
+	b = appendBytesField(b, 4, m.Value)
+	b = appendVarintField(b, 5, uint64(m.Ttl))
+	return b
+}
+
+func unmarshalRequest(data []byte, m *Request) error {
+	*m = Request{}
+	return decode(data, func(num int, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Version = uint32(v)
+		case 2:
+			m.Group = string(b)
+		case 3:
+			m.Key = string(b)
+		case 4:
+			m.Value = append([]byte(nil), b...)
+		case 5:
+			m.Ttl = int64(v)
+		}
+	})
+}
+
+func marshalResponse(m *Response) []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(m.Version))
+	b = appendBytesField(b, 2, []byte(m.Group))
+	b = appendBytesField(b, 3, []byte(m.Key))
+	b = appendBytesField(b, 4, m.Value)
+	b = appendVarintField(b, 5, uint64(m.Ttl))
+	b = appendVarintField(b, 6, uint64(m.ErrorKind))
+	b = appendBytesField(b, 7, []byte(m.Error))
+	return b
+}
+
+func unmarshalResponse(data []byte, m *Response) error {
+	*m = Response{}
+	return decode(data, func(num int, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Version = uint32(v)
+		case 2:
+			m.Group = string(b)
+		case 3:
+			m.Key = string(b)
+		case 4:
+			m.Value = append([]byte(nil), b...)
+		case 5:
+			m.Ttl = int64(v)
+		case 6:
+			m.ErrorKind = ErrorKind(v)
+		case 7:
+			m.Error = string(b)
+		}
+	})
+}
+
+func marshalBatchRequest(m *BatchRequest) []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(m.Version))
+	b = appendBytesField(b, 2, []byte(m.Group))
+	for _, key := range m.Keys {
+		b = appendElement(b, 3, []byte(key))
+	}
+	return b
+}
+
+func unmarshalBatchRequest(data []byte, m *BatchRequest) error {
+	*m = BatchRequest{}
+	return decode(data, func(num int, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Version = uint32(v)
+		case 2:
+			m.Group = string(b)
+		case 3:
+			m.Keys = append(m.Keys, string(b))
+		}
+	})
+}
+
+func marshalBatchResponse(m *BatchResponse) []byte {
+	var b []byte
+	b = appendVarintField(b, 1, uint64(m.Version))
+	for _, res := range m.Responses {
+		b = appendElement(b, 2, marshalResponse(res))
+	}
+	return b
+}
+
+func unmarshalBatchResponse(data []byte, m *BatchResponse) error {
+	*m = BatchResponse{}
+	var err error
+	decodeErr := decode(data, func(num int, v uint64, b []byte) {
+		switch num {
+		case 1:
+			m.Version = uint32(v)
+		case 2:
+			res := new(Response)
+			if e := unmarshalResponse(b, res); e != nil && err == nil {
+				err = e
+			}
+			m.Responses = append(m.Responses, res)
+		}
+	})
+	if decodeErr != nil {
+		return decodeErr
+	}
+	return err
+}
+
+// protobuf 的 wire type
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("wangcachepb: truncated message")
+
+// proto3 中值为零值的字段不需要编码
+func appendVarintField(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytesField(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// repeated 字段的每个元素都需要编码，即使是空值
+func appendElement(b []byte, num int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// 依次解析每个字段，varint 类型的字段值通过 v 传入，length-delimited 类型的字段值通过 b 传入
+// 不认识的字段直接跳过，保证新版本增加字段后旧版本仍然可以解析
+func decode(data []byte, field func(num int, v uint64, b []byte)) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		data = data[n:]
+		num, wire := int(tag>>3), int(tag&7)
+
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return errTruncated
+			}
+			data = data[n:]
+			field(num, v, nil)
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return errTruncated
+			}
+			field(num, 0, data[n:n+int(l)])
+			data = data[n+int(l):]
+		case wireFixed64:
+			if len(data) < 8 {
+				return errTruncated
+			}
+			data = data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return errTruncated
+			}
+			data = data[4:]
+		default:
+			return fmt.Errorf("wangcachepb: unsupported wire type %d", wire)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+//go:build !wangcachepb_nogen
+
+package wangcachepb
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// 手写的编解码 (codec.go) 与 google.golang.org/protobuf 的编码结果相同，并且可以互相解析
+func TestCodecCompat(t *testing.T) {
+	marshal := proto.MarshalOptions{Deterministic: true}
+	check := func(name string, m proto.Message, manual []byte, decode func([]byte) (proto.Message, error)) {
+		t.Helper()
+		expect, err := marshal.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expect, manual) {
+			t.Fatalf("%s: expect % x, but got % x", name, expect, manual)
+		}
+		got, err := decode(expect)
+		if err != nil {
+			t.Fatalf("%s: failed to decode, err: %v", name, err)
+		}
+		if !proto.Equal(m, got) {
+			t.Fatalf("%s: expect %v, but got %v", name, m, got)
+		}
+	}
+
+	requests := []*Request{
+		{},
+		{Version: Version, Group: "scores", Key: "Tom", Value: []byte("630"), Ttl: 60000},
+		{Version: 1 << 31, Key: "空", Value: make([]byte, 300), Ttl: -1},
+	}
+	for _, m := range requests {
+		check("request", m, marshalRequest(m), func(data []byte) (proto.Message, error) {
+			got := new(Request)
+			return got, unmarshalRequest(data, got)
+		})
+	}
+
+	responses := []*Response{
+		{},
+		{Version: Version, Group: "scores", Key: "Tom", Value: []byte("630"), Ttl: 1},
+		{Key: "unknown", ErrorKind: ErrorKind_NOT_FOUND, Error: "key not found"},
+		{ErrorKind: ErrorKind(100)},
+	}
+	for _, m := range responses {
+		check("response", m, marshalResponse(m), func(data []byte) (proto.Message, error) {
+			got := new(Response)
+			return got, unmarshalResponse(data, got)
+		})
+	}
+
+	batchReq := &BatchRequest{Version: Version, Group: "scores", Keys: []string{"Tom", "", "Jack"}}
+	check("batch request", batchReq, marshalBatchRequest(batchReq), func(data []byte) (proto.Message, error) {
+		got := new(BatchRequest)
+		return got, unmarshalBatchRequest(data, got)
+	})
+	batchRes := &BatchResponse{Version: Version, Responses: responses}
+	check("batch response", batchRes, marshalBatchResponse(batchRes), func(data []byte) (proto.Message, error) {
+		got := new(BatchResponse)
+		return got, unmarshalBatchResponse(data, got)
+	})
+
+	// 反方向：手写实现的编码结果可以被生成的代码解析
+	res := &Response{Version: Version, Key: "Jack", Value: []byte("589"), Ttl: 1000, ErrorKind: ErrorKind_INTERNAL, Error: "boom"}
+	got := new(Response)
+	if err := proto.Unmarshal(marshalResponse(res), got); err != nil || !proto.Equal(res, got) {
+		t.Fatalf("expect %v, but got %v, err: %v", res, got, err)
+	}
+}
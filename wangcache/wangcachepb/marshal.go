@@ -0,0 +1,39 @@
+//go:build !wangcachepb_nogen
+
+package wangcachepb
+
+import "google.golang.org/protobuf/proto"
+
+//生成的消息类型上的 Marshal/Unmarshal，与手写实现 (types_nogen.go) 的方法相同，调用方不需要关心使用的是哪一种
+
+func (m *Request) Marshal() ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func (m *Request) Unmarshal(data []byte) error {
+	return proto.Unmarshal(data, m)
+}
+
+func (m *Response) Marshal() ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func (m *Response) Unmarshal(data []byte) error {
+	return proto.Unmarshal(data, m)
+}
+
+func (m *BatchRequest) Marshal() ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func (m *BatchRequest) Unmarshal(data []byte) error {
+	return proto.Unmarshal(data, m)
+}
+
+func (m *BatchResponse) Marshal() ([]byte, error) {
+	return proto.Marshal(m)
+}
+
+func (m *BatchResponse) Unmarshal(data []byte) error {
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,94 @@
+//go:build wangcachepb_nogen
+
+package wangcachepb
+
+import "fmt"
+
+//不使用生成的代码时的消息定义，与 wangcachepb.pb.go 中的类型和字段一一对应，编解码见 codec.go
+
+type ErrorKind int32
+
+const (
+	ErrorKind_NONE          ErrorKind = 0
+	ErrorKind_NOT_FOUND     ErrorKind = 1
+	ErrorKind_NO_SUCH_GROUP ErrorKind = 2
+	ErrorKind_BAD_REQUEST   ErrorKind = 3
+	ErrorKind_INTERNAL      ErrorKind = 4
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKind_NONE:
+		return "NONE"
+	case ErrorKind_NOT_FOUND:
+		return "NOT_FOUND"
+	case ErrorKind_NO_SUCH_GROUP:
+		return "NO_SUCH_GROUP"
+	case ErrorKind_BAD_REQUEST:
+		return "BAD_REQUEST"
+	case ErrorKind_INTERNAL:
+		return "INTERNAL"
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int32(k))
+}
+
+type Request struct {
+	Version uint32
+	Group   string
+	Key     string
+	Value   []byte
+	Ttl     int64
+}
+
+type Response struct {
+	Version   uint32
+	Group     string
+	Key       string
+	Value     []byte
+	Ttl       int64
+	ErrorKind ErrorKind
+	Error     string
+}
+
+type BatchRequest struct {
+	Version uint32
+	Group   string
+	Keys    []string
+}
+
+type BatchResponse struct {
+	Version   uint32
+	Responses []*Response
+}
+
+func (m *Request) Marshal() ([]byte, error) {
+	return marshalRequest(m), nil
+}
+
+func (m *Request) Unmarshal(data []byte) error {
+	return unmarshalRequest(data, m)
+}
+
+func (m *Response) Marshal() ([]byte, error) {
+	return marshalResponse(m), nil
+}
+
+func (m *Response) Unmarshal(data []byte) error {
+	return unmarshalResponse(data, m)
+}
+
+func (m *BatchRequest) Marshal() ([]byte, error) {
+	return marshalBatchRequest(m), nil
+}
+
+func (m *BatchRequest) Unmarshal(data []byte) error {
+	return unmarshalBatchRequest(data, m)
+}
+
+func (m *BatchResponse) Marshal() ([]byte, error) {
+	return marshalBatchResponse(m), nil
+}
+
+func (m *BatchResponse) Unmarshal(data []byte) error {
+	return unmarshalBatchResponse(data, m)
+}
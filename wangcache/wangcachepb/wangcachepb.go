@@ -0,0 +1,16 @@
+package wangcachepb
+
+//节点间通信消息的编解码，消息定义见 wangcachepb.proto
+//默认使用 protoc-gen-go 根据 wangcachepb.proto 生成的代码 (wangcachepb.pb.go)；
+//codec.go 中手写了 protobuf 的二进制编解码 (varint 与 length-delimited 两种编码)，作为不依赖 google.golang.org/protobuf 的后备实现，
+//构建时加上 -tags wangcachepb_nogen 即可使用，两者的编码结果完全相同，可以在同一个集群中共存。
+//修改 wangcachepb.proto 后需要重新生成代码，并保持 codec.go 与之一致 (由 compat_test.go 检查)
+
+//go:generate protoc --go_out=paths=source_relative:. wangcachepb.proto
+//go:generate sed -i "s|^package wangcachepb$|//go:build !wangcachepb_nogen\n\npackage wangcachepb|" wangcachepb.pb.go
+
+// 当前的协议版本号
+const Version = 1
+
+// 使用 protobuf 格式的请求/响应的 Content-Type
+const ContentType = "application/x-protobuf"
@@ -0,0 +1,470 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: wangcachepb.proto
+
+// 节点之间通信使用的消息格式，wangcachepb.pb.go 由本文件生成 (见 wangcachepb.go 中的 go:generate)
+// codec.go 中是手写的编解码实现，与生成的代码在二进制格式上完全兼容，构建时加上 -tags wangcachepb_nogen 使用
+
+//go:build !wangcachepb_nogen
+
+package wangcachepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ErrorKind int32
+
+const (
+	ErrorKind_NONE          ErrorKind = 0
+	ErrorKind_NOT_FOUND     ErrorKind = 1 // 数据源中不存在该key
+	ErrorKind_NO_SUCH_GROUP ErrorKind = 2 // 节点上不存在该group
+	ErrorKind_BAD_REQUEST   ErrorKind = 3
+	ErrorKind_INTERNAL      ErrorKind = 4
+)
+
+// Enum value maps for ErrorKind.
+var (
+	ErrorKind_name = map[int32]string{
+		0: "NONE",
+		1: "NOT_FOUND",
+		2: "NO_SUCH_GROUP",
+		3: "BAD_REQUEST",
+		4: "INTERNAL",
+	}
+	ErrorKind_value = map[string]int32{
+		"NONE":          0,
+		"NOT_FOUND":     1,
+		"NO_SUCH_GROUP": 2,
+		"BAD_REQUEST":   3,
+		"INTERNAL":      4,
+	}
+)
+
+func (x ErrorKind) Enum() *ErrorKind {
+	p := new(ErrorKind)
+	*p = x
+	return p
+}
+
+func (x ErrorKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_wangcachepb_proto_enumTypes[0].Descriptor()
+}
+
+func (ErrorKind) Type() protoreflect.EnumType {
+	return &file_wangcachepb_proto_enumTypes[0]
+}
+
+func (x ErrorKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorKind.Descriptor instead.
+func (ErrorKind) EnumDescriptor() ([]byte, []int) {
+	return file_wangcachepb_proto_rawDescGZIP(), []int{0}
+}
+
+type Request struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"` // 协议版本号
+	Group         string                 `protobuf:"bytes,2,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"` // 设置缓存时的缓存值
+	Ttl           int64                  `protobuf:"varint,5,opt,name=ttl,proto3" json:"ttl,omitempty"`    // 设置缓存时的过期时间(毫秒)，0 表示使用对方节点的默认过期时间
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Request) Reset() {
+	*x = Request{}
+	mi := &file_wangcachepb_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Request) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Request) ProtoMessage() {}
+
+func (x *Request) ProtoReflect() protoreflect.Message {
+	mi := &file_wangcachepb_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Request.ProtoReflect.Descriptor instead.
+func (*Request) Descriptor() ([]byte, []int) {
+	return file_wangcachepb_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Request) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Request) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Request) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Request) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Request) GetTtl() int64 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+type Response struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Group         string                 `protobuf:"bytes,2,opt,name=group,proto3" json:"group,omitempty"`
+	Key           string                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Value         []byte                 `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"`
+	Ttl           int64                  `protobuf:"varint,5,opt,name=ttl,proto3" json:"ttl,omitempty"` // 缓存值剩余的过期时间(毫秒)，0 表示永不过期
+	ErrorKind     ErrorKind              `protobuf:"varint,6,opt,name=error_kind,json=errorKind,proto3,enum=wangcachepb.ErrorKind" json:"error_kind,omitempty"`
+	Error         string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"` // 错误信息
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	mi := &file_wangcachepb_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_wangcachepb_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_wangcachepb_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Response) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Response) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Response) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Response) GetValue() []byte {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Response) GetTtl() int64 {
+	if x != nil {
+		return x.Ttl
+	}
+	return 0
+}
+
+func (x *Response) GetErrorKind() ErrorKind {
+	if x != nil {
+		return x.ErrorKind
+	}
+	return ErrorKind_NONE
+}
+
+func (x *Response) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// 批量获取多个key，见 HTTPPool 的 /_batch/ 接口
+type BatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Group         string                 `protobuf:"bytes,2,opt,name=group,proto3" json:"group,omitempty"`
+	Keys          []string               `protobuf:"bytes,3,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_wangcachepb_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_wangcachepb_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_wangcachepb_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *BatchRequest) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *BatchRequest) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *BatchRequest) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type BatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Responses     []*Response            `protobuf:"bytes,2,rep,name=responses,proto3" json:"responses,omitempty"` // 与 BatchRequest.keys 一一对应
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchResponse) Reset() {
+	*x = BatchResponse{}
+	mi := &file_wangcachepb_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchResponse) ProtoMessage() {}
+
+func (x *BatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_wangcachepb_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchResponse.ProtoReflect.Descriptor instead.
+func (*BatchResponse) Descriptor() ([]byte, []int) {
+	return file_wangcachepb_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchResponse) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *BatchResponse) GetResponses() []*Response {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+var File_wangcachepb_proto protoreflect.FileDescriptor
+
+const file_wangcachepb_proto_rawDesc = "" +
+	"\n" +
+	"\x11wangcachepb.proto\x12\vwangcachepb\"s\n" +
+	"\aRequest\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x12\x14\n" +
+	"\x05group\x18\x02 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\fR\x05value\x12\x10\n" +
+	"\x03ttl\x18\x05 \x01(\x03R\x03ttl\"\xc1\x01\n" +
+	"\bResponse\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x12\x14\n" +
+	"\x05group\x18\x02 \x01(\tR\x05group\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\fR\x05value\x12\x10\n" +
+	"\x03ttl\x18\x05 \x01(\x03R\x03ttl\x125\n" +
+	"\n" +
+	"error_kind\x18\x06 \x01(\x0e2\x16.wangcachepb.ErrorKindR\terrorKind\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\"R\n" +
+	"\fBatchRequest\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x12\x14\n" +
+	"\x05group\x18\x02 \x01(\tR\x05group\x12\x12\n" +
+	"\x04keys\x18\x03 \x03(\tR\x04keys\"^\n" +
+	"\rBatchResponse\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x123\n" +
+	"\tresponses\x18\x02 \x03(\v2\x15.wangcachepb.ResponseR\tresponses*V\n" +
+	"\tErrorKind\x12\b\n" +
+	"\x04NONE\x10\x00\x12\r\n" +
+	"\tNOT_FOUND\x10\x01\x12\x11\n" +
+	"\rNO_SUCH_GROUP\x10\x02\x12\x0f\n" +
+	"\vBAD_REQUEST\x10\x03\x12\f\n" +
+	"\bINTERNAL\x10\x042\xa2\x02\n" +
+	"\tWangCache\x122\n" +
+	"\x03Get\x12\x14.wangcachepb.Request\x1a\x15.wangcachepb.Response\x12;\n" +
+	"\bGetBatch\x12\x14.wangcachepb.Request\x1a\x15.wangcachepb.Response(\x010\x01\x122\n" +
+	"\x03Set\x12\x14.wangcachepb.Request\x1a\x15.wangcachepb.Response\x125\n" +
+	"\x06Remove\x12\x14.wangcachepb.Request\x1a\x15.wangcachepb.Response\x129\n" +
+	"\n" +
+	"Invalidate\x12\x14.wangcachepb.Request\x1a\x15.wangcachepb.ResponseB%Z#7go/wangCache/wangcache/wangcachepbb\x06proto3"
+
+var (
+	file_wangcachepb_proto_rawDescOnce sync.Once
+	file_wangcachepb_proto_rawDescData []byte
+)
+
+func file_wangcachepb_proto_rawDescGZIP() []byte {
+	file_wangcachepb_proto_rawDescOnce.Do(func() {
+		file_wangcachepb_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_wangcachepb_proto_rawDesc), len(file_wangcachepb_proto_rawDesc)))
+	})
+	return file_wangcachepb_proto_rawDescData
+}
+
+var file_wangcachepb_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_wangcachepb_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_wangcachepb_proto_goTypes = []any{
+	(ErrorKind)(0),        // 0: wangcachepb.ErrorKind
+	(*Request)(nil),       // 1: wangcachepb.Request
+	(*Response)(nil),      // 2: wangcachepb.Response
+	(*BatchRequest)(nil),  // 3: wangcachepb.BatchRequest
+	(*BatchResponse)(nil), // 4: wangcachepb.BatchResponse
+}
+var file_wangcachepb_proto_depIdxs = []int32{
+	0, // 0: wangcachepb.Response.error_kind:type_name -> wangcachepb.ErrorKind
+	2, // 1: wangcachepb.BatchResponse.responses:type_name -> wangcachepb.Response
+	1, // 2: wangcachepb.WangCache.Get:input_type -> wangcachepb.Request
+	1, // 3: wangcachepb.WangCache.GetBatch:input_type -> wangcachepb.Request
+	1, // 4: wangcachepb.WangCache.Set:input_type -> wangcachepb.Request
+	1, // 5: wangcachepb.WangCache.Remove:input_type -> wangcachepb.Request
+	1, // 6: wangcachepb.WangCache.Invalidate:input_type -> wangcachepb.Request
+	2, // 7: wangcachepb.WangCache.Get:output_type -> wangcachepb.Response
+	2, // 8: wangcachepb.WangCache.GetBatch:output_type -> wangcachepb.Response
+	2, // 9: wangcachepb.WangCache.Set:output_type -> wangcachepb.Response
+	2, // 10: wangcachepb.WangCache.Remove:output_type -> wangcachepb.Response
+	2, // 11: wangcachepb.WangCache.Invalidate:output_type -> wangcachepb.Response
+	7, // [7:12] is the sub-list for method output_type
+	2, // [2:7] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_wangcachepb_proto_init() }
+func file_wangcachepb_proto_init() {
+	if File_wangcachepb_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_wangcachepb_proto_rawDesc), len(file_wangcachepb_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_wangcachepb_proto_goTypes,
+		DependencyIndexes: file_wangcachepb_proto_depIdxs,
+		EnumInfos:         file_wangcachepb_proto_enumTypes,
+		MessageInfos:      file_wangcachepb_proto_msgTypes,
+	}.Build()
+	File_wangcachepb_proto = out.File
+	file_wangcachepb_proto_goTypes = nil
+	file_wangcachepb_proto_depIdxs = nil
+}
@@ -0,0 +1,104 @@
+package wangcachepb
+
+import (
+	"bytes"
+	"testing"
+)
+
+type message interface {
+	Marshal() ([]byte, error)
+}
+
+// 两个消息的所有字段是否相同，生成的类型带有内部状态，不能直接用 reflect.DeepEqual 比较
+func equal(a, b message) bool {
+	x, errA := a.Marshal()
+	y, errB := b.Marshal()
+	return errA == nil && errB == nil && bytes.Equal(x, y)
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	req := &Request{Version: Version, Group: "scores", Key: "Tom", Value: []byte("630"), Ttl: 60000}
+	data, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Request)
+	if err := got.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !equal(req, got) {
+		t.Fatalf("expect %+v, but got %+v", req, got)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	res := &Response{Version: Version, Key: "unknown", ErrorKind: ErrorKind_NOT_FOUND, Error: "key not found"}
+	data, err := res.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(Response)
+	if err := got.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !equal(res, got) {
+		t.Fatalf("expect %+v, but got %+v", res, got)
+	}
+}
+
+// 编码结果需要与标准 protobuf 实现一致
+func TestWireFormat(t *testing.T) {
+	data, _ := (&Request{Version: 1, Group: "g", Key: "k", Ttl: 300}).Marshal()
+	expect := []byte{0x08, 0x01, 0x12, 0x01, 'g', 0x1a, 0x01, 'k', 0x28, 0xac, 0x02}
+	if !bytes.Equal(expect, data) {
+		t.Fatalf("expect % x, but got % x", expect, data)
+	}
+}
+
+// 不认识的字段需要被跳过，保证新旧版本可以共存
+func TestUnknownFields(t *testing.T) {
+	data, _ := (&Response{Value: []byte("630")}).Marshal()
+	// 追加 field 15 (varint)、field 16 (bytes)、field 17 (fixed32)
+	data = append(data, 0x78, 0x01, 0x82, 0x01, 0x02, 'x', 'y', 0x8d, 0x01, 0, 0, 0, 0)
+
+	got := new(Response)
+	if err := got.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Value) != "630" {
+		t.Fatalf("expect value 630, but got %s", got.Value)
+	}
+
+	if err := got.Unmarshal(data[:len(data)-1]); err == nil {
+		t.Fatalf("expect error for truncated message")
+	}
+}
+
+func TestBatchRoundTrip(t *testing.T) {
+	// 空的key和空的响应也需要保留，保证与请求一一对应
+	req := &BatchRequest{Version: Version, Group: "scores", Keys: []string{"Tom", "", "Jack"}}
+	data, _ := req.Marshal()
+	gotReq := new(BatchRequest)
+	if err := gotReq.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !equal(req, gotReq) {
+		t.Fatalf("expect %+v, but got %+v", req, gotReq)
+	}
+
+	res := &BatchResponse{Version: Version, Responses: []*Response{
+		{Key: "Tom", Value: []byte("630"), Ttl: 1000},
+		{},
+		{Key: "Jack", ErrorKind: ErrorKind_NOT_FOUND, Error: "key not found"},
+	}}
+	data, _ = res.Marshal()
+	gotRes := new(BatchResponse)
+	if err := gotRes.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !equal(res, gotRes) {
+		t.Fatalf("expect %+v, but got %+v", res, gotRes)
+	}
+}